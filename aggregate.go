@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// query the counter on all nodes and evaluate the thresholds once against the
+// aggregated value. the per node values are added as perfdata.
+func aggregateNodes(nodes []string, object string) *checkResult {
+	values := []float64{}
+	nodePerfdata := []string{}
+	uom := ""
+	invalid := 0
+
+	for _, node := range nodes {
+		r := queryHost(ipAddr, node, object, counterName, objectInstance)
+		if r == nil {
+			return &checkResult{returnVal: 3, text: "no counter name given"}
+		}
+		if r.notFound {
+			debugPrintf(3, "node %s skipped: %s\n", node, r.text)
+			continue
+		}
+		if r.label == "" {
+			return &checkResult{node: node, returnVal: 3, text: fmt.Sprintf("%s: %s", node, r.text)}
+		}
+		nodePerfdata = append(nodePerfdata, fmt.Sprintf("%s/%s=%s%s;;;;", node, r.label, r.value, r.uom))
+		// values not available, e.g. U of -invalid-value-as ok, are left out
+		value, err := strconv.ParseFloat(r.value, 64)
+		if err != nil {
+			debugPrintf(3, "node %s value %s not aggregated\n", node, r.value)
+			invalid++
+			continue
+		}
+		values = append(values, value)
+		uom = r.uom
+	}
+
+	switch {
+	case len(values) == 0 && invalid > 0:
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("%s,%s,%s no valid value on any node", outputPrefix, objectInstance, counterName), extraPerfdata: nodePerfdata}
+	case len(values) == 0:
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("Counter not found on any node: %s", counterName)}
+	}
+
+	aggregated := values[0]
+	switch nodeAggregate {
+	case "sum", "avg":
+		aggregated = 0
+		for _, v := range values {
+			aggregated += v
+		}
+		if nodeAggregate == "avg" {
+			aggregated = aggregated / float64(len(values))
+		}
+	case "min":
+		for _, v := range values {
+			if v < aggregated {
+				aggregated = v
+			}
+		}
+	case "max":
+		for _, v := range values {
+			if v > aggregated {
+				aggregated = v
+			}
+		}
+	default:
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("unknown node aggregation: %s", nodeAggregate)}
+	}
+
+	returnVal := getNagiosReturnVal(aggregated, warningThreshold, criticalThreshold)
+	debugPrintf(3, "%s of %d nodes: %f returnVal: %d\n", nodeAggregate, len(values), aggregated, returnVal)
+
+	certText := ""
+	if warnCertDays > 0 {
+		if certText = certExpiryText(ipAddr); certText != "" && returnVal < 1 {
+			returnVal = 1
+		}
+	}
+
+	aggregatedText := strconv.FormatFloat(aggregated, 'f', -1, 64)
+	return &checkResult{
+		returnVal:     returnVal,
+		text:          fmt.Sprintf("%s,%s,%s %s of %d nodes=%s%s%s", outputPrefix, objectInstance, counterName, nodeAggregate, len(values), aggregatedText, uom, certText),
+		label:         counterName,
+		value:         aggregatedText,
+		uom:           uom,
+		warning:       warningThreshold,
+		critical:      criticalThreshold,
+		extraPerfdata: nodePerfdata,
+	}
+}
+
+// cluster call load: CallsActive (or the -n counter, e.g. CallsInProgress) of
+// the Cisco CallManager object summed across all nodes. the nodes are
+// discovered via AXL like -all-nodes, a -M or -N list leaving out a node of
+// the cluster is UNKNOWN as the sum would be too low.
+func checkClusterCalls(nodes []string) *checkResult {
+	if !allNodes {
+		discovered, err := discoverNodes(ipAddr)
+		if err != nil {
+			return &checkResult{returnVal: 3, text: fmt.Sprintf("AXL node discovery failed: %s", err)}
+		}
+		if flagGiven("M") || flagGiven("N") {
+			given := map[string]bool{}
+			for _, node := range nodes {
+				given[strings.ToLower(node)] = true
+			}
+			missing := []string{}
+			for _, node := range discovered {
+				if !given[strings.ToLower(node)] {
+					missing = append(missing, node)
+				}
+			}
+			if len(missing) > 0 {
+				return &checkResult{returnVal: 3, text: fmt.Sprintf("cluster-calls needs all cluster nodes, missing: %s, use -all-nodes", strings.Join(missing, ", "))}
+			}
+		}
+		nodes = discovered
+	}
+	if !flagGiven("o") {
+		objectInstance = "Cisco CallManager"
+	}
+	if counterName == "" {
+		counterName = "CallsActive"
+	}
+	nodeAggregate = "sum"
+	return aggregateNodes(nodes, perfmonObject(objectInstance))
+}
+
+// -dry-run plan of -mode cluster-calls
+func dryRunClusterCalls(object string) (*dryRunPlan, error) {
+	counter, instance := counterName, objectInstance
+	if counter == "" {
+		counter = "CallsActive"
+	}
+	if !flagGiven("o") {
+		object, instance = "Cisco CallManager", "Cisco CallManager"
+	}
+	return &dryRunPlan{
+		queries: []dryRunQuery{{object, instance, counter, "sum " + warningThreshold, "sum " + criticalThreshold}},
+		lines:   []string{"nodes: all cluster nodes discovered via AXL on " + ipAddr},
+	}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// perfdata of all counters of the object in the response except the evaluated
+// counter, filtered by the comma separated -all-perfdata-filter glob patterns
+// and ordered and limited by -sort and -limit.
+// like in the thresholds file a pattern without \ matches the counter name only.
+func objectPerfdata(counterEnvelope *CounterEnvelope, nodeIpAddr, object, evaluatedCounter string) []string {
+	filters := []*regexp.Regexp{}
+	patterns := []string{}
+	for _, pattern := range strings.Split(allPerfdataFilter, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		re, err := globRegexp(pattern)
+		if err != nil {
+			debugPrintf(1, "invalid -all-perfdata-filter pattern %s: %s\n", pattern, err)
+			continue
+		}
+		filters = append(filters, re)
+		patterns = append(patterns, pattern)
+	}
+
+	entries := []listEntry{}
+	prefix := "\\\\" + nodeIpAddr + "\\"
+	for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+		if v.Name.Text == evaluatedCounter {
+			continue
+		}
+		instanceCounter := strings.TrimPrefix(v.Name.Text, prefix)
+		if (!strings.HasPrefix(instanceCounter, object+"(") && !strings.HasPrefix(instanceCounter, object+"\\")) || !instanceAllowed(instanceOf(instanceCounter)) {
+			continue
+		}
+		matched := len(filters) == 0
+		counter := instanceCounter[strings.LastIndex(instanceCounter, "\\")+1:]
+		for i, re := range filters {
+			name := instanceCounter
+			if !strings.Contains(patterns[i], "\\") {
+				name = counter
+			}
+			if re.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			valueText := counterValueText(v.Value.Text)
+			if invalidValue(valueText) {
+				if invalidValueAs != "skip" {
+					entries = append(entries, listEntry{name: instanceCounter, perfdata: fmt.Sprintf("%s=U;;;;", instanceCounter)})
+				}
+				continue
+			}
+			value, _ := strconv.ParseFloat(valueText, 64)
+			entries = append(entries, listEntry{name: instanceCounter, value: value, perfdata: fmt.Sprintf("%s=%s;;;;", instanceCounter, valueText)})
+		}
+	}
+	_, perfdata := sortLimitEntries(entries)
+	return perfdata
+}
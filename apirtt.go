@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// check the PerfmonPort response time itself, averaged over -samples requests.
+// the thresholds are given in milliseconds.
+func checkAPIResponseTime() *checkResult {
+	if apiSamples < 1 {
+		apiSamples = 1
+	}
+
+	var total time.Duration
+	for i := 0; i < apiSamples; i++ {
+		start := time.Now()
+		if _, _, err := perfmonRequest(ipAddr, &PerfmonCollectCounterData{Host: nodeIpAddr, Object: perfmonObject(objectInstance)}); err != nil {
+			return &checkResult{node: nodeIpAddr, returnVal: 3, text: err.Error()}
+		}
+		elapsed := time.Since(start)
+		debugPrintf(3, "sample %d response time: %s\n", i+1, elapsed)
+		total += elapsed
+	}
+
+	responseTime := float64(total.Milliseconds()) / float64(apiSamples)
+	returnVal := getNagiosReturnVal(responseTime, warningThreshold, criticalThreshold)
+	valueText := fmt.Sprintf("%.0f", responseTime)
+	return &checkResult{
+		node:      nodeIpAddr,
+		returnVal: returnVal,
+		text:      fmt.Sprintf("%s API response time=%sms (average of %d requests)", outputPrefix, valueText, apiSamples),
+		label:     "response_time",
+		value:     valueText,
+		uom:       "ms",
+		warning:   warningThreshold,
+		critical:  criticalThreshold,
+	}
+}
+
+// -dry-run plan of -mode api-rtt, the requests of the -o object are timed
+func dryRunAPIResponseTime(object string) (*dryRunPlan, error) {
+	return &dryRunPlan{queries: []dryRunQuery{{object, objectInstance, counterName, warningThreshold, criticalThreshold}}}, nil
+}
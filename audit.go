@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// record the invocation and its result in the -audit-log file or in syslog.
+// file lines are tab separated: timestamp, cluster, node, mode, object,
+// counter, state and value. syslog sends the same fields as key=value pairs
+// to the local syslog socket, syslog://host[:port] to a remote syslog via UDP.
+func writeAudit(r *checkResult) {
+	if auditLog == "" {
+		return
+	}
+	node := r.node
+	if node == "" {
+		node = nodeIpAddr
+		if nodesIpAddrs != "" {
+			node = nodesIpAddrs
+		}
+	}
+	mode := checkMode
+	if mode == "" {
+		mode = "counter"
+	}
+	cluster := ipAddr
+	if clusterList != "" || clustersFile != "" {
+		cluster = strings.TrimSpace(clusterList + " " + clustersFile)
+	}
+	fields := []string{cluster, node, mode, objectInstance, counterName, returnValText(r.returnVal), r.value}
+
+	var err error
+	if auditLog == "syslog" || strings.HasPrefix(auditLog, "syslog://") {
+		err = writeAuditSyslog(fields)
+	} else {
+		err = writeAuditFile(fields)
+	}
+	if err != nil {
+		debugPrintf(1, "audit log error: %s\n", err)
+	}
+}
+
+func writeAuditFile(fields []string) error {
+	f, err := os.OpenFile(auditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\n", time.Now().Format(time.RFC3339), strings.Join(fields, "\t"))
+	return err
+}
+
+// RFC 3164 message with facility user and severity notice
+func writeAuditSyslog(fields []string) error {
+	var conn net.Conn
+	var err error
+	if strings.HasPrefix(auditLog, "syslog://") {
+		address := strings.TrimPrefix(auditLog, "syslog://")
+		if _, _, splitErr := net.SplitHostPort(address); splitErr != nil {
+			address = net.JoinHostPort(address, "514")
+		}
+		conn, err = net.Dial("udp", address)
+	} else {
+		for _, socket := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if conn, err = net.Dial("unixgram", socket); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	names := []string{"cluster", "node", "mode", "object", "counter", "state", "value"}
+	pairs := []string{}
+	for i, field := range fields {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", names[i], field))
+	}
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(conn, "<13>%s %s %s[%d]: %s", time.Now().Format(time.Stamp), hostname, path.Base(os.Args[0]), os.Getpid(), strings.Join(pairs, " "))
+	return err
+}
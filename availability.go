@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// object of the availability request, a handful of counters on every node
+const availabilityObject = "System"
+
+// request the System counters of a node bypassing the cache and validate the
+// response. returns the response time and the reason the service is unavailable.
+func perfmonAvailable(node string) (time.Duration, error) {
+	start := time.Now()
+	if transport == "rest" {
+		if _, _, err := restCollectCounterData(ipAddr, node, availabilityObject); err != nil {
+			return time.Since(start), err
+		}
+		return time.Since(start), nil
+	}
+
+	request := perfmonRequestXML(&PerfmonCollectCounterData{Host: node, Object: availabilityObject})
+	resp, body, _, err := soapRequest(ipAddr, "/perfmonservice/services/PerfmonPort", perfmonSOAPAction(), request)
+	elapsed := time.Since(start)
+	if err != nil {
+		return elapsed, fmt.Errorf("HTTPS request error: %s", err)
+	}
+	fault := struct {
+		Body struct {
+			Fault struct {
+				Faultstring string `xml:"faultstring"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}{}
+	xml.Unmarshal(body, &fault)
+	if fault.Body.Fault.Faultstring != "" {
+		return elapsed, fmt.Errorf("SOAP fault: %s", fault.Body.Fault.Faultstring)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return elapsed, fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	counterEnvelope := new(CounterEnvelope)
+	if err := xml.Unmarshal(body, counterEnvelope); err != nil {
+		return elapsed, fmt.Errorf("XML unmarshal error: %s", err)
+	}
+	if len(counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo) == 0 {
+		return elapsed, fmt.Errorf("no %s counters in the response", availabilityObject)
+	}
+	return elapsed, nil
+}
+
+// check that the PerfmonPort service of every node answers a valid response,
+// CRITICAL if not. -w and -c are response time thresholds in milliseconds if
+// given. meant as parent check of the counter checks of the nodes.
+func checkAvailability(nodes []string) *checkResult {
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, problemPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, problemPrefix = node+"/", node+" "
+		}
+		elapsed, err := perfmonAvailable(node)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 2)
+			problems = append(problems, fmt.Sprintf("%sunavailable: %s", problemPrefix, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(2), err))
+			continue
+		}
+
+		responseTime := float64(elapsed.Milliseconds())
+		warning, critical := givenThresholds()
+		returnVal := givenThresholdsReturnVal(responseTime, warning, critical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%sresponse time %.0fms %s", problemPrefix, responseTime, returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata, fmt.Sprintf("%sresponse_time=%.0fms;%s;%s;0;", labelPrefix, responseTime, warning, critical))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - PerfmonPort answered in %.0fms", node, returnValText(returnVal), responseTime))
+	}
+
+	summary := "available"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s PerfmonPort %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode availability
+func dryRunAvailability(object string) (*dryRunPlan, error) {
+	warning, critical := givenThresholds()
+	if warning != "" {
+		warning += " ms"
+	}
+	if critical != "" {
+		critical += " ms"
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{availabilityObject, availabilityObject, "", warning, critical}}, uncached: true}, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+type (
+	AxlSQLQueryEnvelope struct {
+		XMLName xml.Name `xml:"Envelope"`
+		Body    struct {
+			ExecuteSQLQueryResponse struct {
+				Return struct {
+					Row []struct {
+						Fields []struct {
+							XMLName xml.Name
+							Text    string `xml:",chardata"`
+						} `xml:",any"`
+					} `xml:"row"`
+				} `xml:"return"`
+			} `xml:"executeSQLQueryResponse"`
+			Fault struct {
+				Faultstring string `xml:"faultstring"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+
+	// list of cluster nodes discovered via AXL, cached like perfmon objects
+	DiscoveredNodes struct {
+		Nodes []string
+	}
+)
+
+// run an AXL executeSQLQuery on the CUCM publisher and return the rows as column name to value maps
+func axlSQLQuery(ipAddr, sql string) ([]map[string]string, error) {
+	request := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns="http://www.cisco.com/AXL/API/%s"><soapenv:Header/><soapenv:Body><ns:executeSQLQuery><sql>%s</sql></ns:executeSQLQuery></soapenv:Body></soapenv:Envelope>`, apiVersion, html.EscapeString(sql))
+	debugPrintf(3, "AXL SOAP request: %s\n", request)
+
+	resp, body, _, err := soapRequest(ipAddr, "/axl/", "CUCM:DB ver="+apiVersion+" executeSQLQuery", request)
+	if err != nil {
+		return nil, err
+	}
+	debugPrintf(3, "AXL SOAP response: %s\n", body)
+
+	envelope := new(AxlSQLQueryEnvelope)
+	err = xml.Unmarshal(body, envelope)
+	if envelope.Body.Fault.Faultstring != "" {
+		return nil, fmt.Errorf("AXL fault: %s", envelope.Body.Fault.Faultstring)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AXL HTTP status: %s", resp.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("AXL XML unmarshal error: %s", err)
+	}
+
+	rows := []map[string]string{}
+	for _, r := range envelope.Body.ExecuteSQLQueryResponse.Return.Row {
+		row := map[string]string{}
+		for _, f := range r.Fields {
+			row[f.XMLName.Local] = strings.TrimSpace(f.Text)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// discover all nodes of the cluster via AXL. the node list is cached for the maximum cache age,
+// so newly added subscribers are picked up automatically.
+func discoverNodes(ipAddr string) ([]string, error) {
+	discovered := new(DiscoveredNodes)
+	if loadStruct(ipAddr, "AXL processnode", maxCacheAge, discovered) {
+		debugPrintf(3, "discovered nodes from cache: %v\n", discovered.Nodes)
+		return discovered.Nodes, nil
+	}
+
+	rows, err := axlSQLQuery(ipAddr, "select name from processnode where systemnode = 'f'")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row["name"] != "" {
+			discovered.Nodes = append(discovered.Nodes, row["name"])
+		}
+	}
+	if len(discovered.Nodes) == 0 {
+		return nil, fmt.Errorf("no nodes found")
+	}
+	debugPrintf(3, "discovered nodes: %v\n", discovered.Nodes)
+	saveStruct(ipAddr, "AXL processnode", discovered)
+	return discovered.Nodes, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// latency percentile of sorted durations, nearest rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// perform count collect calls and report latency percentiles and the error rate.
+// failed requests and non 200 responses (e.g. API throttling) are not part of
+// the latency percentiles.
+func runBench(count int) *checkResult {
+	request := perfmonRequestXML(&PerfmonCollectCounterData{Host: nodeIpAddr, Object: perfmonObject(objectInstance)})
+	latencies := []time.Duration{}
+	errors := 0
+	var lastErr error
+
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		requestStart := time.Now()
+		resp, _, _, err := soapRequest(ipAddr, "/perfmonservice/services/PerfmonPort", perfmonSOAPAction(), request)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("HTTP status %s", resp.Status)
+		}
+		if err != nil {
+			debugPrintf(2, "bench request %d error: %s\n", i+1, err)
+			errors++
+			lastErr = err
+			continue
+		}
+		latencies = append(latencies, time.Since(requestStart))
+	}
+	elapsed := time.Since(start)
+
+	if len(latencies) == 0 {
+		return &checkResult{node: nodeIpAddr, returnVal: 3, text: fmt.Sprintf("%s bench: all %d requests failed: %s", outputPrefix, count, lastErr)}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.1f", float64(d.Microseconds())/1000)
+	}
+	p50, p95, p99 := ms(percentile(latencies, 50)), ms(percentile(latencies, 95)), ms(percentile(latencies, 99))
+	errorRate := float64(errors) * 100 / float64(count)
+
+	return &checkResult{
+		node:      nodeIpAddr,
+		returnVal: 0,
+		text: fmt.Sprintf("%s bench %d requests in %.1fs: p50=%sms p95=%sms p99=%sms, %d errors (error rate %.1f percent)",
+			outputPrefix, count, elapsed.Seconds(), p50, p95, p99, errors, errorRate),
+		extraPerfdata: []string{
+			fmt.Sprintf("p50=%sms;;;;", p50),
+			fmt.Sprintf("p95=%sms;;;;", p95),
+			fmt.Sprintf("p99=%sms;;;;", p99),
+			fmt.Sprintf("errors=%d;;;0;%d", errors, count),
+		},
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parse -cache-ages: object=age entries separated by ; or @filename of a file
+// with one entry per line. the age is in seconds like -m or a duration like 10m.
+func parseCacheAges(spec string) (map[string]int64, error) {
+	ages := map[string]int64{}
+	if spec == "" {
+		return ages, nil
+	}
+
+	entries := []string{}
+	if strings.HasPrefix(spec, "@") {
+		lines, err := readListFile(strings.TrimPrefix(spec, "@"))
+		if err != nil {
+			return nil, err
+		}
+		entries = lines
+	} else {
+		entries = strings.Split(spec, ";")
+	}
+
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pos := strings.LastIndex(entry, "=")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid cache age %q, expected object=seconds", entry)
+		}
+		value := strings.TrimSpace(entry[pos+1:])
+		age, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			d, derr := time.ParseDuration(value)
+			if derr != nil {
+				return nil, fmt.Errorf("invalid cache age %q, expected object=seconds", entry)
+			}
+			age = int64(d.Seconds())
+		}
+		ages[strings.ToLower(strings.TrimSpace(entry[:pos]))] = age
+	}
+	return ages, nil
+}
+
+// maximum cache age of an object, -m unless overridden by -cache-ages
+func objectCacheAge(object string) int64 {
+	if age, ok := objectCacheAges[strings.ToLower(object)]; ok {
+		return age
+	}
+	return maxCacheAge
+}
+
+// opportunistic pruning at the end of a run at most once per interval
+const pruneInterval = time.Hour
+
+// cache file with its size and modification time
+type cacheEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// remove the cache files of this user older than -cache-max-age, then the
+// oldest files while the cache is larger than -cache-max-size MB. returns
+// the number of removed files and their bytes.
+func pruneCacheFiles(now time.Time) (int, int64, error) {
+	dir, prefix := filepath.Split(cacheFileName("", ""))
+	prefix = strings.TrimSuffix(prefix, "__")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	entries := []cacheEntry{}
+	var total int64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix+"_") {
+			continue
+		}
+		entries = append(entries, cacheEntry{filepath.Join(dir, f.Name()), f.Size(), f.ModTime()})
+		total += f.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	removed := 0
+	var removedBytes int64
+	for _, e := range entries {
+		tooOld := cacheMaxAge > 0 && now.Sub(e.modTime) > cacheMaxAge
+		tooLarge := cacheMaxSize > 0 && total > cacheMaxSize*1024*1024
+		if !tooOld && !tooLarge {
+			// sorted by age, newer files are neither too old
+			break
+		}
+		if err := os.Remove(e.name); err != nil && !os.IsNotExist(err) {
+			debugPrintf(1, "cache prune error: %s\n", err)
+			continue
+		}
+		debugPrintf(3, "cache file %s removed\n", e.name)
+		removed++
+		removedBytes += e.size
+		total -= e.size
+	}
+	return removed, removedBytes, nil
+}
+
+// prune the cache if the last pruning is older than pruneInterval, the
+// modification time of the prune marker file is the time of the last pruning
+func pruneCacheOpportunistic() {
+	if noCache || (cacheMaxAge <= 0 && cacheMaxSize <= 0) {
+		return
+	}
+	now := time.Now()
+	marker := cacheFileName("", "prune")
+	if fs, err := os.Stat(marker); err == nil && now.Sub(fs.ModTime()) < pruneInterval {
+		return
+	}
+	if err := ioutil.WriteFile(marker, nil, 0644); err != nil {
+		debugPrintf(1, "cache prune error: %s\n", err)
+		return
+	}
+	if removed, removedBytes, err := pruneCacheFiles(now); err != nil {
+		debugPrintf(1, "cache prune error: %s\n", err)
+	} else if removed > 0 {
+		debugPrintf(2, "cache pruned: %d files, %d bytes removed\n", removed, removedBytes)
+	}
+}
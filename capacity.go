@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// value in percent of the -capacity-counter of the same object instance
+func capacityPercent(counterEnvelope *CounterEnvelope, nodeIpAddr, objectInstance string, value float64) (float64, string, error) {
+	fullCounterName := getFullCounterName(nodeIpAddr, objectInstance, capacityCounter)
+	capacityText, found := findCounterValue(counterEnvelope, fullCounterName)
+	if !found {
+		return 0, "", fmt.Errorf("Capacity counter not found: %s", fullCounterName)
+	}
+	capacity, err := strconv.ParseFloat(capacityText, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("Capacity counter value string to float64 convert error: %s", err)
+	}
+	if capacity <= 0 {
+		return 0, "", fmt.Errorf("Capacity counter %s is %s", capacityCounter, capacityText)
+	}
+	return value / capacity * 100, capacityText, nil
+}
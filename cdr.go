@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CDR Agent counters of -mode cdr
+const (
+	cdrObject          = "Cisco CDR Agent"
+	cdrPendingCounter  = "CDRFilesPendingDelivery"
+	cdrFailuresCounter = "CDRFlushFailures"
+)
+
+// check the CDR and CMR files waiting on every node for delivery to the CDR
+// repository and billing servers: -w and -c are the pending files and only
+// evaluated if given, every new flush failure since the previous run is
+// CRITICAL as CDR data got lost
+func checkCDR(nodes []string) *checkResult {
+	object := cdrObject
+	if flagGiven("o") {
+		object = perfmonObject(objectInstance)
+	}
+	warning, critical := givenThresholds()
+
+	state := currentCheckState()
+	if state == nil {
+		return &checkResult{returnVal: 3, text: "CDR check needs the state file, see -state-dir"}
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, problemPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, problemPrefix = node+"/", node+" "
+		}
+		// always fetched, new flush failures need the current value
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+		value := func(counter string) (float64, bool) {
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, object, counter))
+			v, err := strconv.ParseFloat(valueText, 64)
+			return v, found && err == nil
+		}
+
+		returnVal := 0
+		details := []string{}
+		if pending, ok := value(cdrPendingCounter); ok {
+			returnVal = givenThresholdsReturnVal(pending, warning, critical)
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s%.0f files pending %s", problemPrefix, pending, returnValText(returnVal)))
+			}
+			details = append(details, fmt.Sprintf("%.0f files pending", pending))
+			perfdata = append(perfdata, fmt.Sprintf("%spending_files=%.0f;%s;%s;0;", labelPrefix, pending, warning, critical))
+		} else {
+			returnVal = 3
+			problems = append(problems, fmt.Sprintf("%s%s n/a", problemPrefix, cdrPendingCounter))
+		}
+
+		if failures, ok := value(cdrFailuresCounter); ok {
+			key := "cdr failures " + node
+			last, err := strconv.ParseFloat(state.Data[key], 64)
+			state.Data[key] = strconv.FormatFloat(failures, 'f', -1, 64)
+			// a lower value is a restarted CDR Agent
+			if err == nil && failures > last {
+				returnVal = 2
+				problems = append(problems, fmt.Sprintf("%s%.0f new CDR flush failures", problemPrefix, failures-last))
+				details = append(details, fmt.Sprintf("%.0f new flush failures", failures-last))
+			} else {
+				details = append(details, "no new flush failures")
+			}
+			perfdata = append(perfdata, fmt.Sprintf("%sflush_failures=%.0fc;;;0;", labelPrefix, failures))
+		}
+
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(returnVal), strings.Join(details, ", ")))
+	}
+
+	summary := "CDR delivery OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d nodes: %s", outputPrefix, object, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode cdr
+func dryRunCDR(object string) (*dryRunPlan, error) {
+	instance := objectInstance
+	if !flagGiven("o") {
+		object, instance = cdrObject, cdrObject
+	}
+	warning, critical := givenThresholds()
+	return &dryRunPlan{queries: []dryRunQuery{{object, instance, cdrPendingCounter, warning, critical},
+		{object, instance, cdrFailuresCounter, "", "increase"}}}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// NotAfter of the certificate presented by the CUCM Tomcat during the last HTTPS request
+var serverCertNotAfter time.Time
+
+// TLS client config used for all connections to the CUCM Tomcat
+func newTLSConfig() *tls.Config {
+	return fipsTLSConfig(&tls.Config{
+		InsecureSkipVerify: cucmRootCAs == nil,
+		RootCAs:            cucmRootCAs,
+		MaxVersion:         tls.VersionTLS11,
+	})
+}
+
+// TLS client config of the Expressway/VCS status API. Expressway X8.10 and
+// later only accept TLS 1.2, only the -ca and -fips settings are shared
+// with the CUCM config.
+func newExpresswayTLSConfig() *tls.Config {
+	return fipsTLSConfig(&tls.Config{
+		InsecureSkipVerify: cucmRootCAs == nil,
+		RootCAs:            cucmRootCAs,
+		MinVersion:         tls.VersionTLS12,
+	})
+}
+
+// fetch the server certificate expiry date by a TLS handshake only.
+// used if the counter data was loaded from the cache and no request was made.
+func fetchCertNotAfter(hostList string) (time.Time, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var lastErr error
+	for _, host := range apiHosts(hostList) {
+		conn, err := tls.DialWithDialer(dialer, "tcp", host+":8443", newTLSConfig())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		defer conn.Close()
+		certs := conn.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			return time.Time{}, nil
+		}
+		return certs[0].NotAfter, nil
+	}
+	return time.Time{}, lastErr
+}
+
+// returns the text appended to the plugin output if the server certificate
+// expires within warnCertDays days, otherwise an empty string
+func certExpiryText(ipAddr string) string {
+	if serverCertNotAfter.IsZero() && replayFile == "" {
+		notAfter, err := fetchCertNotAfter(ipAddr)
+		if err != nil {
+			debugPrintf(2, "certificate expiry check TLS handshake error: %s\n", err)
+			return ""
+		}
+		serverCertNotAfter = notAfter
+	}
+	if serverCertNotAfter.IsZero() {
+		return ""
+	}
+
+	days := int(time.Until(serverCertNotAfter).Hours() / 24)
+	debugPrintf(3, "server certificate expires: %s (%d days)\n", serverCertNotAfter, days)
+	if days >= warnCertDays {
+		return ""
+	}
+	return fmt.Sprintf(" - WARNING server certificate expires in %d days (%s)", days, serverCertNotAfter.Format("2006-01-02"))
+}
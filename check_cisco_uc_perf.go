@@ -14,7 +14,8 @@
 // General Public Licence (see http://www.fsf.org/licensing/licenses/gpl.txt).
 //
 // log files and cache file:
-//  		befor first use create the following log files and cache file
+//  		befor first use create the following log files and cache file,
+//  		the log file only if it is given with -L
 //  		touch /var/log/check_cisco_uc_perf.log
 //  		chown nagios.nagios /var/log/check_cisco_uc_perf.log
 //
@@ -48,17 +49,19 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
 	"html"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -172,31 +175,189 @@ type (
 )
 
 var (
-	ipAddr            string
-	nodeIpAddr        string
-	nodesIpAddrs      string
-	username          string
-	password          string
-	objectInstance    string
-	counterName       string
-	debug             int
-	warningThreshold  string
-	criticalThreshold string
-	showVersion       bool
-	showCounters      bool
-	maxCacheAge       int64
-	apiVersion        string
-	usePersistData    bool
-	returnVal         int
-	multipeNodes      bool
-	logFileName       string
-	cacheFilePath     string
+	ipAddr                 string
+	nodeIpAddr             string
+	nodesIpAddrs           string
+	username               string
+	password               string
+	objectInstance         string
+	counterName            string
+	debug                  int
+	warningThreshold       string
+	criticalThreshold      string
+	showVersion            bool
+	showCounters           bool
+	maxCacheAge            int64
+	apiVersion             string
+	usePersistData         bool
+	returnVal              int
+	multipeNodes           bool
+	logFileName            string
+	cacheFilePath          string
+	warnCertDays           int
+	clusterList            string
+	clustersFile           string
+	allNodes               bool
+	nodeAggregate          string
+	healthCheck            bool
+	prefetchObjects        string
+	nodeThresholdList      string
+	nodeThresholds         map[string][2]string
+	snmpTrapTarget         string
+	snmpVersion            string
+	snmpCommunity          string
+	snmpTrapOID            string
+	snmpUser               string
+	snmpAuthProto          string
+	snmpAuthPass           string
+	snmpPrivPass           string
+	snmpEngineID           string
+	eventLogFileName       string
+	stateDir               string
+	selfPerfdata           bool
+	startTime              time.Time
+	apiRoundTrip           time.Duration
+	apiRequests            int
+	checkMode              string
+	apiSamples             int
+	dryRun                 bool
+	replayFile             string
+	recordDir              string
+	benchCount             int
+	catalogCacheAge        int64
+	ignoreCase             bool
+	scoreWeights           string
+	thresholdsFile         string
+	outputTemplateText     string
+	perfdataOnly           bool
+	checkResultsDir        string
+	checkResultHost        string
+	checkResultService     string
+	checkResultsWritten    bool
+	icinga2API             string
+	icinga2User            string
+	icinga2Password        string
+	icinga2CA              string
+	icinga2Cert            string
+	icinga2Key             string
+	icinga2CheckSource     string
+	kafkaBrokers           string
+	kafkaTopic             string
+	kafkaTLS               bool
+	kafkaCA                string
+	kafkaSaslUser          string
+	kafkaSaslPassword      string
+	metricsOutput          string
+	mqttBroker             string
+	mqttUser               string
+	mqttPassword           string
+	mqttCA                 string
+	mqttTopicTemplate      string
+	mqttClientID           string
+	mqttQoS                int
+	esURL                  string
+	esIndex                string
+	esUser                 string
+	esPassword             string
+	esAPIKey               string
+	esCA                   string
+	historyEnabled         bool
+	historyRetention       time.Duration
+	trendWindow            time.Duration
+	trendWarning           string
+	trendCritical          string
+	rrdDir                 string
+	rrdStep                int
+	rrdtoolPath            string
+	oauthTokenURL          string
+	oauthClientID          string
+	oauthClientSecret      string
+	oauthScope             string
+	oauthGrant             string
+	sessionReuse           bool
+	sessionTTL             time.Duration
+	transport              string
+	restPath               string
+	product                string
+	cpuPegged              float64
+	heartbeatStall         time.Duration
+	rtmtAlertList          string
+	capacityCounter        string
+	describeCounters       bool
+	unknownAsOK            bool
+	criticalCap            string
+	versionJSON            bool
+	auditLog               string
+	allPerfdata            bool
+	allPerfdataFilter      string
+	topInstances           int
+	instanceSort           string
+	instanceLimit          int
+	includeInstances       string
+	excludeInstances       string
+	timeThresholdList      string
+	warmup                 time.Duration
+	uptimeCounter          string
+	protocolCounters       string
+	protocolThresholds     string
+	pilotThresholdList     string
+	huntWaitThreshold      string
+	huntAbandonedThreshold string
+	presenceThresholdList  string
+	tftpNotFoundThreshold  string
+	serveAddr              string
+	serveCert              string
+	serveKey               string
+	serveToken             string
+	serveMax               int
+	serveTimeout           time.Duration
+	serverURL              string
+	cacheGzip              bool
+	cacheAgeList           string
+	objectCacheAges        map[string]int64
+	noCache                bool
+	cacheMaxSize           int64
+	cacheMaxAge            time.Duration
+	pruneCache             bool
+	precision              int
+	convertUnit            string
+	scaleFactor            float64
+	nearThresholdPercent   float64
+	soapAction             string
+	soapEnvelopeNamespace  string
+	soapNamespace          string
+	soapNoPrefix           bool
+	extraOpts              string
+	instanceName           string
+	invalidValueAs         string
+	invalidValues          string
+	fipsMode               bool // defaults to fipsDefault, builds with -tags fips enforce the FIPS mode
+	cucmCA                 string
+	correlationID          string
+	showCorrelationID      bool
+	checkUpdate            bool
+	outputFormat           string
+	stuckRuns              int
+	expectValue            string
+	expectOneOf            string
+	valueMap               string
+	cmrDir                 string
+	cmrInterval            time.Duration
+	cmrSFTP                string
+	cmrSFTPPassword        string
+	qualityThresholds      string
+	ilsCounterList         string
+	ilsThresholdList       string
+	ssoPath                string
+	serveHosts             string
+	serverCA               string
+	serverPin              string
 )
 
 func debugPrintf(level int, format string, a ...interface{}) {
 
 	if level == 1 || level <= debug {
-		log.Printf(format, a...)
+		log.Print(correlationPrefix() + fmt.Sprintf(format, a...))
 	}
 }
 
@@ -213,8 +374,17 @@ func isFullQualified(counterName string) bool {
 	}
 }
 
+// cache file of a perfmon object of a node
+func cacheFileName(ipAddr, object string) string {
+	objectUnderscore := strings.Replace(object, " ", "_", -1)
+	return fmt.Sprintf("%s%s%d_%s_%s", cacheFilePath, chacheFilePrefix, os.Getuid(), ipAddr, objectUnderscore)
+}
+
 // save struct to json file in tmp dir
-func saveStruct(ipAddr, object string, o *CounterEnvelope) bool {
+func saveStruct(ipAddr, object string, o interface{}) bool {
+	if noCache {
+		return false
+	}
 
 	itemJson, err := json.Marshal(o)
 	if err != nil {
@@ -222,10 +392,21 @@ func saveStruct(ipAddr, object string, o *CounterEnvelope) bool {
 		return false
 	}
 
-	objectUnderscore := strings.Replace(object, " ", "_", -1)
-	filename := fmt.Sprintf("%s%s%d_%s_%s", cacheFilePath, chacheFilePrefix, os.Getuid(), ipAddr, objectUnderscore)
+	if cacheGzip {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write(itemJson)
+		if err := zw.Close(); err != nil {
+			debugPrintf(1, "error: %s", err)
+			return false
+		}
+		itemJson = b.Bytes()
+	}
+
+	filename := cacheFileName(ipAddr, object)
 
-	err = ioutil.WriteFile(filename, itemJson, 0666)
+	// concurrent checks, e.g. of -serve, read the cache while it is written
+	err = writeFileAtomic(filename, itemJson, 0644)
 
 	if err != nil {
 		debugPrintf(1, "error: %s", err)
@@ -235,11 +416,37 @@ func saveStruct(ipAddr, object string, o *CounterEnvelope) bool {
 	return true
 }
 
+// write a file via a temporary file renamed to filename, readers never see
+// a partially written file
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
 // load struct from json file in tmp dir if newer than defined in ageInSeconds
-func loadStruct(ipAddr, object string, ageInSeconds int64, o *CounterEnvelope) bool {
+func loadStruct(ipAddr, object string, ageInSeconds int64, o interface{}) bool {
+	if noCache {
+		return false
+	}
 
-	objectUnderscore := strings.Replace(object, " ", "_", -1)
-	filename := fmt.Sprintf("%s%s%d_%s_%s", cacheFilePath, chacheFilePrefix, os.Getuid(), ipAddr, objectUnderscore)
+	filename := cacheFileName(ipAddr, object)
 
 	fs, err := os.Stat(filename)
 	if err != nil {
@@ -257,7 +464,18 @@ func loadStruct(ipAddr, object string, ageInSeconds int64, o *CounterEnvelope) b
 		debugPrintf(1, "error: %s", err)
 		return false
 	}
-	err = json.Unmarshal(data, &o)
+	// gzip compressed or plain JSON of older versions and -cache-gzip=false
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			data, err = ioutil.ReadAll(zr)
+		}
+		if err != nil {
+			debugPrintf(1, "error: %s", err)
+			return false
+		}
+	}
+	err = json.Unmarshal(data, o)
 	if err != nil {
 		debugPrintf(1, "error: %s", err)
 		return false
@@ -327,234 +545,1161 @@ func returnValText(returnVal int) string {
 }
 
 func init() {
-	flag.StringVar(&ipAddr, "H", "", "CUCM server IP address")
-	flag.StringVar(&nodeIpAddr, "N", "", "Node IP address")
-	flag.StringVar(&nodesIpAddrs, "M", "", "Comma separated list of nodes (IP addresses)")
+	flag.StringVar(&ipAddr, "H", "", "CUCM server IP address, optionally a comma separated list of API endpoints tried in order")
+	flag.StringVar(&nodeIpAddr, "N", "", "Node IP address, default the first -H server")
+	flag.StringVar(&nodesIpAddrs, "M", "", "Comma separated list of nodes (IP addresses) or @filename of a file with one node per line, the counter is checked on every node")
+	flag.StringVar(&extraOpts, "extra-opts", "", "Read options from the [section] of an ini file: -extra-opts=[section][@file], default section the plugin name and file the first plugins.ini of the monitoring plugins locations. the command line flags override them")
 	flag.StringVar(&username, "u", "", "username")
 	flag.StringVar(&password, "p", "", "password")
-	flag.StringVar(&objectInstance, "o", "Memory", "Perfmon object with optional tailing instance names in parenthesis")
+	flag.StringVar(&product, "product", "cucm", "Product type with its default object, health indicators and score weights: cucm, imp (IM and Presence) or cer (Cisco Emergency Responder)")
+	flag.StringVar(&objectInstance, "o", "Memory", "Perfmon object with optional tailing instance names in parenthesis, several comma separated instances are evaluated each")
 	flag.StringVar(&counterName, "n", "", "Counter name")
+	flag.StringVar(&instanceName, "i", "", "Instance of the -o object, or comma separated instances, instead of object(instance) in -o")
+	flag.StringVar(&instanceName, "instance", "", "Same as -i")
 	flag.IntVar(&debug, "d", 0, "print debug, level: 1 errors only, 2 warnings and 3 informational messages")
 	flag.StringVar(&warningThreshold, "w", "1", "Warning threshold or threshold range")
 	flag.StringVar(&criticalThreshold, "c", "1", "Critical threshold or threshold range")
-	flag.BoolVar(&showVersion, "V", false, "print plugin version")
+	flag.BoolVar(&showVersion, "V", false, "print plugin version and build information")
+	flag.BoolVar(&versionJSON, "version-json", false, "print the version and build information as JSON")
+	flag.BoolVar(&checkUpdate, "check-update", false, "Compare the version with the latest GitHub release, printed by -V and logged with -d. Cached for a day, the check result is never affected if offline")
 	flag.BoolVar(&showCounters, "l", false, "print PerfmonListCounter")
+	flag.Float64Var(&scaleFactor, "scale", 1, "Multiply the raw counter value by this factor before the evaluation and output, e.g. 0.0000001 for counters in 100 nanosecond units")
+	flag.StringVar(&convertUnit, "convert", "", "Convert the counter value for evaluation, output and perfdata, the thresholds are in the converted unit: bytes2kb, bytes2mb, bytes2gb, kb2mb, kb2gb, mb2gb, us2ms, us2s or ms2s")
+	flag.StringVar(&invalidValueAs, "invalid-value-as", "evaluate", "Handling of the -invalid-values counter values meaning not available: evaluate against the thresholds, unknown, ok, or skip the value (multi-node checks leave the node out)")
+	flag.StringVar(&invalidValues, "invalid-values", "-1,4294967295", "Comma separated raw counter values meaning not available, see -invalid-value-as")
+	flag.IntVar(&precision, "precision", -1, "Round counter values to this number of decimal places for evaluation, output and perfdata, -1 keeps all decimal places")
 	flag.Int64Var(&maxCacheAge, "m", 180, "maximum cache age in seconds")
+	flag.StringVar(&cacheAgeList, "cache-ages", "", "Per object maximum cache age overrides of -m object=seconds separated by ;, e.g. \"Partition=600;Cisco CallManager=10\", or @filename with one entry per line")
+	flag.BoolVar(&noCache, "no-cache", false, "Neither read nor write the cache files in this run, all values are fetched from the server")
+	flag.DurationVar(&cacheMaxAge, "cache-max-age", 7*24*time.Hour, "Remove cache files not written for this duration, checked at the end of a run at most once per hour. 0 keeps them")
+	flag.Int64Var(&cacheMaxSize, "cache-max-size", 0, "Remove the oldest cache files while the cache files are larger than this size in MB, 0 for no limit")
+	flag.BoolVar(&pruneCache, "prune-cache", false, "Prune the cache files by -cache-max-age and -cache-max-size now and exit")
+	flag.BoolVar(&cacheGzip, "cache-gzip", true, "Write the cache files gzip compressed, plain JSON cache files are read as well")
+	flag.Int64Var(&catalogCacheAge, "catalog-cache-age", 86400, "maximum cache age of the perfmonListCounter counter catalog in seconds, 0 disables the catalog cache")
 	flag.StringVar(&apiVersion, "A", "9.0", "Cisco AXL API version of AXL XML Namespace")
-	flag.StringVar(&logFileName, "L", "/var/log/check_cisco_uc_perf.log", "Log file path and name")
+	flag.StringVar(&soapAction, "soap-action", "CUCM:DB ver={version}", "SOAPAction header of the PerfmonPort requests, {version} is replaced with -A")
+	flag.StringVar(&soapEnvelopeNamespace, "soap-envelope-ns", defaultSOAPEnvelopeNamespace, "Namespace of the soapenv: envelope of the PerfmonPort and RisPort requests")
+	flag.StringVar(&soapNamespace, "soap-ns", defaultSOAPNamespace, "Namespace of the PerfmonPort and RisPort request elements")
+	flag.BoolVar(&soapNoPrefix, "soap-no-prefix", false, "Send the PerfmonPort and RisPort request elements without soap: prefix in the -soap-ns default namespace")
+	flag.StringVar(&logFileName, "L", "", "Log file path and name, e.g. /var/log/check_cisco_uc_perf.log. without -L messages are only printed to stderr with -d, if the file can't be opened they are printed to stderr")
 	flag.StringVar(&cacheFilePath, "C", "/tmp/check_cisco_uc_perf/", "Cache file path")
+	flag.IntVar(&warnCertDays, "warn-cert-days", 0, "WARNING if the server certificate expires within given days, 0 disables the check")
+	flag.StringVar(&clusterList, "clusters", "", "Comma separated list of CUCM publishers, the check or -mode is run against each cluster")
+	flag.StringVar(&clustersFile, "clusters-file", "", "File with one CUCM publisher per line: host [username [password]]")
+	flag.StringVar(&timeThresholdList, "time-thresholds", "", "Thresholds of time windows replacing -w and -c and the default thresholds of the modes: [days] HH:MM-HH:MM=warning,critical separated by ; or @filename, e.g. \"Mon-Fri 08:00-18:00=80,90;18:00-08:00=40,60\"")
+	flag.StringVar(&nodeThresholdList, "node-thresholds", "", "Per node threshold overrides node=warning,critical separated by ; or @filename with one entry per line")
+	flag.StringVar(&nodeAggregate, "node-aggregate", "", "Evaluate the counter aggregated across all -M nodes: sum, avg, min or max")
+	flag.StringVar(&checkMode, "mode", "", "Check mode instead of a counter check: health, score, cpu (-w/-c average % CPU Time of the cores, default 80 and 90), memory, heartbeat, uptime (-w/-c ranges in seconds, default 3600:15552000 and 600:), cluster-calls (CallsActive sum of all nodes discovered via AXL), route-list (RouteListExhausted per minute), locations (LBM bandwidth used percent), device-pools (RisPort unregistered phones per device pool, -w/-c only if given, a pool without registered phones is CRITICAL), inventory (registered phones by model and protocol), registrations (registered stations per protocol), hunt (queued calls per hunt pilot), presence (IM and Presence subscriptions, sessions and SIP proxy errors), tftp (aborted requests per minute and heartbeat), cdr (Cisco CDR Agent files pending delivery, -w/-c only if given, and flush failures), tomcat (Cisco Tomcat JVM heap used percent), availability (PerfmonPort answers valid responses, -w/-c response time in ms), stuck (-n counter unchanged in -stuck-runs consecutive runs, -w/-c ranges of the unchanged runs), call-quality (MOS, jitter, latency and packet loss of the CMR records, see -cmr-dir), ils (Intercluster Lookup Service sync status, learned objects and failed syncs per minute), sso (SAML SSO redirects to the identity provider, -w/-c ssosp errors per minute), smart-license (Smart Licensing registration and authorization of the cluster via AXL, -w/-c days until the authorization expires, default 30: and 7:), api-rtt or expressway (Expressway/VCS status API with -n zones or a status value)")
+	flag.BoolVar(&healthCheck, "health", false, "Cluster health summary of CPU, memory, disk, replication and CallManager key counters of all nodes, same as -mode health")
+	flag.StringVar(&thresholdsFile, "thresholds-file", "", "Check all counters of the -o object without -n, file lines: counter or object(instance)\\counter glob pattern, warning and critical threshold")
+	flag.Float64Var(&cpuPegged, "cpu-pegged", 95, "-mode cpu: at least WARNING if a single core reaches this % CPU Time")
+	flag.StringVar(&expectValue, "expect", "", "CRITICAL if the counter value is not this value instead of the -w/-c ranges, for enumerated counters like Replicate_State")
+	flag.StringVar(&expectOneOf, "expect-one-of", "", "CRITICAL if the counter value is not one of these comma separated values, e.g. 1,2")
+	flag.StringVar(&valueMap, "value-map", "", "Print the meaning of enumerated counter values, comma separated value=meaning list or the preset replication")
+	flag.StringVar(&cmrDir, "cmr-dir", "", "-mode call-quality: directory of the CMR files delivered by CDRonDemand (-cmr-sftp) or the CDR repository billing server")
+	flag.DurationVar(&cmrInterval, "cmr-interval", 15*time.Minute, "-mode call-quality: evaluate the CMR records of this last interval")
+	flag.StringVar(&cmrSFTP, "cmr-sftp", "", "-mode call-quality: user@host:directory CDRonDemand sends the CMR files of the interval to by SFTP, usually this poller with -cmr-dir as directory")
+	flag.StringVar(&cmrSFTPPassword, "cmr-sftp-password", "", "Password of the -cmr-sftp user")
+	flag.StringVar(&qualityThresholds, "quality-thresholds", "", "Thresholds of -mode call-quality name=warning,critical separated by ;, names: mos_avg, mos_p5, jitter_avg, jitter_p95, latency_avg, latency_p95 (ms), loss_avg, loss_p95 (percent). default "+defaultQualityThresholds)
+	flag.IntVar(&stuckRuns, "stuck-runs", 3, "-mode stuck: CRITICAL if the counter value is identical in this many consecutive runs")
+	flag.DurationVar(&heartbeatStall, "heartbeat-stall", 0, "-mode heartbeat and tftp: CRITICAL if the heartbeat counter did not change for this duration, 0 for any run without change")
+	flag.StringVar(&protocolCounters, "protocol-counters", "SIP=Cisco SIP Station\\StationsRegistered,SCCP=Cisco SCCP Station\\StationsRegistered", "Comma separated protocol=object\\counter list of the registered stations per protocol for -mode registrations")
+	flag.StringVar(&protocolThresholds, "protocol-thresholds", "", "Thresholds of -mode registrations per protocol separated by ;, e.g. \"SIP=500:,100:;SCCP=,10:\"")
+	flag.StringVar(&pilotThresholdList, "pilot-thresholds", "", "Queued calls thresholds of -mode hunt per hunt pilot pattern=warning,critical separated by ;, * and ? match any characters")
+	flag.StringVar(&huntWaitThreshold, "hunt-wait", "", "Warning range of the longest waiting time in seconds for -mode hunt")
+	flag.StringVar(&huntAbandonedThreshold, "hunt-abandoned", "", "Warning range of the abandoned calls per minute for -mode hunt")
+	flag.StringVar(&presenceThresholdList, "presence-thresholds", "", "Thresholds of -mode presence name=warning,critical separated by ;, names: subscriptions (default -w and -c if given), jsm_sessions and proxy_errors (per minute)")
+	flag.StringVar(&ssoPath, "sso-path", "/ccmadmin/showHome.do", "-mode sso: page of the nodes redirecting to the SAML identity provider, e.g. /ucmuser/ for Self Care")
+	flag.StringVar(&ilsCounterList, "ils-counters", defaultILSCounters, "Comma separated name=object\\counter list of the -mode ils counters sync_status, learned_objects and failed_syncs (per minute)")
+	flag.StringVar(&ilsThresholdList, "ils-thresholds", "", "Thresholds of -mode ils name=warning,critical separated by ;, e.g. \"sync_status=1:1,1:1\". default "+defaultILSThresholds)
+	flag.StringVar(&tftpNotFoundThreshold, "tftp-not-found", "", "Warning range of the not found requests per minute for -mode tftp")
+	flag.StringVar(&serveAddr, "serve", "", "Serve checks over HTTPS on this address, e.g. :8444. POST /check with a JSON body {\"host\", \"node\", \"object\", \"counter\", \"warning\", \"critical\", \"mode\", \"args\"} runs the check with the cache, session and state files of the server")
+	flag.StringVar(&serveCert, "serve-cert", "", "PEM certificate file of -serve, a self signed certificate if not given")
+	flag.StringVar(&serveKey, "serve-key", "", "PEM private key file of -serve-cert")
+	flag.StringVar(&serveToken, "serve-token", "", "Bearer token required by -serve and sent by -server, -serve refuses to start without it")
+	flag.StringVar(&serveHosts, "serve-hosts", "", "Comma separated CUCM hosts check requests of -serve may query in addition to the -H and -clusters-file hosts of the server")
+	flag.IntVar(&serveMax, "serve-max", 4, "Maximum number of checks -serve runs at the same time")
+	flag.DurationVar(&serveTimeout, "serve-timeout", 60*time.Second, "Timeout of a check run by -serve")
+	flag.StringVar(&serverURL, "server", "", "Run the check on a -serve server, e.g. https://poller:8444, instead of locally. the server is verified with -server-ca or -server-pin")
+	flag.StringVar(&serverCA, "server-ca", "", "PEM CA certificate file verifying the -server certificate")
+	flag.StringVar(&serverPin, "server-pin", "", "SHA-256 fingerprint (hex) of the -server certificate as logged by -serve, e.g. for the self signed certificate")
+	flag.StringVar(&cucmCA, "ca", "", "CA certificate file to verify the CUCM Tomcat certificate, not verified if not given")
+	flag.StringVar(&correlationID, "correlation-id", "", "Correlation ID prefixed to every log line, a random ID per invocation if not given. Node and request numbers are appended and the requests send it as X-Request-ID header")
+	flag.BoolVar(&showCorrelationID, "show-correlation-id", false, "Append the correlation ID to the long output")
+	flag.BoolVar(&fipsMode, "fips", fipsDefault, "FIPS mode: TLS 1.2 or later with FIPS approved cipher suites and curves only, certificates are always verified (needs -ca). Enforced by builds with -tags fips")
+	flag.StringVar(&rtmtAlertList, "rtmt", "", "Evaluate the comma separated RTMT alerts with their default thresholds, e.g. CpuPegging,LowAvailableVirtualMemory=25: or all. name=range overrides the threshold")
+	flag.StringVar(&capacityCounter, "capacity-counter", "", "Counter of the same object instance holding the capacity, the thresholds are percent of it e.g. -n CallsActive with the maximum calls counter")
+	flag.BoolVar(&describeCounters, "describe", false, "Append the counter description of perfmonQueryCounterDescription to the long output, cached like the counter catalog")
+	flag.BoolVar(&unknownAsOK, "unknown-as-ok", false, "Report UNKNOWN as OK, e.g. during planned upgrades")
+	flag.StringVar(&criticalCap, "critical-cap", "", "Report CRITICAL as the given state, warning during planned upgrades")
+	flag.BoolVar(&allPerfdata, "all-perfdata", false, "Add all counters of the object in the response as perfdata, only the -n counter is evaluated")
+	flag.StringVar(&allPerfdataFilter, "all-perfdata-filter", "", "Comma separated counter or object(instance)\\counter glob patterns of the -all-perfdata counters")
+	flag.Float64Var(&nearThresholdPercent, "show-near-threshold", 0, "List the counters of the object within the given percent of their warning or critical threshold in long output, 0 = off")
+	flag.IntVar(&topInstances, "top", 0, "List the given number of instances of the object with the highest -n counter values in long output, e.g. with -o \"Processor(_Total)\"")
+	flag.StringVar(&instanceSort, "sort", "", "Order of multi-instance output (-thresholds-file, -all-perfdata, -top): value (descending) or name, default response order")
+	flag.IntVar(&instanceLimit, "limit", 0, "Maximum number of long output lines and perfdata entries of multi-instance output, 0 for no limit")
+	flag.StringVar(&includeInstances, "include-instance", "", "Comma separated glob patterns of the instances in multi-instance output and -mode cpu, others are ignored")
+	flag.StringVar(&excludeInstances, "exclude-instance", "", "Comma separated glob patterns of ignored instances, e.g. test trunks or spare partitions")
+	flag.DurationVar(&warmup, "warmup", 0, "Report WARNING and CRITICAL as OK while the node uptime is below this grace period, e.g. 15m after a reboot")
+	flag.StringVar(&uptimeCounter, "uptime-counter", "System Up Time", "Uptime counter in seconds of the System object, used by -warmup and -mode uptime")
+	flag.StringVar(&scoreWeights, "score-weights", defaultScoreWeights, "Comma separated name=weight components of -mode score, names are -mode health indicators or object(instance)\\counter of percent counters")
+	flag.IntVar(&apiSamples, "samples", 1, "Number of requests averaged in -mode api-rtt")
+	flag.StringVar(&prefetchObjects, "prefetch", "", "Cache warm mode for cron: collect and cache the comma separated objects (or @filename) of all nodes")
+	flag.BoolVar(&selfPerfdata, "self-perfdata", false, "Append the average Perfmon API round trip time api_rtt_ms and plugin_runtime_ms as perfdata")
+	flag.BoolVar(&historyEnabled, "history", false, "Record every value in a history file next to the state file, required by the trend thresholds")
+	flag.DurationVar(&historyRetention, "history-retention", 30*24*time.Hour, "Keep the history samples for this duration")
+	flag.DurationVar(&trendWindow, "trend-window", 24*time.Hour, "Time window of the trend thresholds")
+	flag.StringVar(&trendWarning, "trend-warning", "", "Warning threshold range of the value growth in percent over -trend-window, e.g. ~:20 for more than 20 percent growth")
+	flag.StringVar(&trendCritical, "trend-critical", "", "Critical threshold range of the value growth in percent over -trend-window")
+	flag.StringVar(&stateDir, "state-dir", "/var/tmp/check_cisco_uc_perf/", "Directory of the per check state files (previous values and states)")
+	flag.StringVar(&auditLog, "audit-log", "", "Record every invocation (cluster, node, object, counter, state, value) in this file, syslog for the local syslog or syslog://host[:port]")
+	flag.StringVar(&eventLogFileName, "event-log", "", "Append state changes (timestamp, check, old state, new state, value) to this file")
+	flag.StringVar(&snmpTrapTarget, "snmp-trap-target", "", "Send an SNMP trap to host[:port] when the evaluated state changes")
+	flag.StringVar(&snmpVersion, "snmp-version", "2c", "SNMP trap version: 2c or 3")
+	flag.StringVar(&snmpCommunity, "snmp-community", "public", "SNMPv2c trap community")
+	flag.StringVar(&snmpTrapOID, "snmp-trap-oid", "1.3.6.1.4.1.20006.1", "SNMP trap OID, varbinds are sent as trap OID .1 host, .2 check, .3 state, .4 previous state, .5 output")
+	flag.StringVar(&snmpUser, "snmp-user", "", "SNMPv3 user name")
+	flag.StringVar(&snmpAuthProto, "snmp-auth-proto", "SHA", "SNMPv3 authentication protocol: MD5 or SHA")
+	flag.StringVar(&snmpAuthPass, "snmp-auth-pass", "", "SNMPv3 authentication passphrase, empty for noAuthNoPriv")
+	flag.StringVar(&snmpPrivPass, "snmp-priv-pass", "", "SNMPv3 AES privacy passphrase, empty for authNoPriv")
+	flag.StringVar(&snmpEngineID, "snmp-engine-id", "", "SNMPv3 authoritative engine ID in hex (default derived from the hostname)")
+	flag.BoolVar(&allNodes, "all-nodes", false, "Discover all cluster nodes via AXL on the -H publisher and query each of them")
+	flag.StringVar(&replayFile, "replay", "", "Parse a saved PerfmonPort SOAP response file instead of querying the server")
+	flag.StringVar(&recordDir, "record", "", "Save the sanitized SOAP requests and responses of the run to this directory")
+	flag.IntVar(&benchCount, "bench", 0, "Perform given number of collect calls and report latency percentiles and the error rate")
+	flag.BoolVar(&ignoreCase, "ignore-case", false, "Match object and counter names case-insensitive")
+	flag.StringVar(&outputFormat, "output-format", "", "Long output of composite checks (-M, -clusters, -mode health, -thresholds-file) as child checks: multi (check_multi \"[ 1] name STATE - text\") or icinga (\"[STATE] name: text\" colored by Icinga Web)")
+	flag.StringVar(&outputTemplateText, "output-template", "", "Go text/template (or @filename) of the plugin output with .Status .ReturnCode .Node .Counter .Instance .Value .Warning .Critical .Text .Perfdata .Instances .LongOutput")
+	flag.BoolVar(&perfdataOnly, "perfdata-only", false, "Print only the perfdata and exit 0, for metrics collectors like Telegraf or collectd exec")
+	flag.StringVar(&checkResultsDir, "checkresults-dir", "", "Also write the result as passive check result to this Nagios checkresults spool directory")
+	flag.StringVar(&checkResultHost, "checkresult-host", "", "Nagios or Icinga2 host name of the spooled or submitted check results, default the node. {node} is replaced with the node")
+	flag.StringVar(&checkResultService, "checkresult-service", "", "Nagios or Icinga2 service name of the spooled or submitted check results. with -M and {node} one result per node is written")
+	flag.StringVar(&oauthTokenURL, "oauth-token-url", "", "OAuth2 token endpoint, send Bearer tokens instead of basic auth to the API")
+	flag.StringVar(&oauthClientID, "oauth-client-id", "", "OAuth2 client id")
+	flag.StringVar(&oauthClientSecret, "oauth-client-secret", "", "OAuth2 client secret")
+	flag.StringVar(&oauthScope, "oauth-scope", "", "OAuth2 scope")
+	flag.StringVar(&oauthGrant, "oauth-grant", "client_credentials", "OAuth2 grant type: client_credentials, or password with -u and -p")
+	flag.StringVar(&transport, "transport", "soap", "Serviceability API transport: soap, or rest for the JSON perfmon REST calls of CUCM 14+")
+	flag.StringVar(&restPath, "rest-path", "/perfmonservice/rest/v1", "base path of the perfmon REST calls of -transport rest")
+	flag.BoolVar(&sessionReuse, "session-reuse", false, "Reuse the Tomcat session cookies of the previous runs of the same host and -u user instead of basic auth, saved in the cache dir")
+	flag.DurationVar(&sessionTTL, "session-ttl", 20*time.Minute, "Maximum age of reused session cookies")
+	flag.StringVar(&icinga2API, "icinga2-api", "", "Also submit the result as passive check result to this Icinga2 API URL, e.g. https://icinga2:5665")
+	flag.StringVar(&icinga2User, "icinga2-user", "", "Icinga2 API user")
+	flag.StringVar(&icinga2Password, "icinga2-password", "", "Icinga2 API password")
+	flag.StringVar(&icinga2CA, "icinga2-ca", "", "CA certificate file to verify the Icinga2 API certificate")
+	flag.StringVar(&icinga2Cert, "icinga2-cert", "", "client certificate file for the Icinga2 API")
+	flag.StringVar(&icinga2Key, "icinga2-key", "", "client key file for the Icinga2 API")
+	flag.StringVar(&icinga2CheckSource, "icinga2-check-source", "check_cisco_uc_perf", "check source of the results submitted to the Icinga2 API")
+	flag.StringVar(&metricsOutput, "output", "", "Comma separated metrics outputs publishing the counter values: kafka, mqtt, elasticsearch, rrd. kafka is also enabled by -kafka-brokers")
+	flag.StringVar(&mqttBroker, "mqtt-broker", "tcp://localhost:1883", "MQTT broker URL, tcp:// or ssl://")
+	flag.StringVar(&mqttUser, "mqtt-user", "", "MQTT username")
+	flag.StringVar(&mqttPassword, "mqtt-password", "", "MQTT password")
+	flag.StringVar(&mqttCA, "mqtt-ca", "", "CA certificate file to verify the MQTT broker certificate")
+	flag.StringVar(&mqttTopicTemplate, "mqtt-topic", "cucm/{{.Host}}/{{.Node}}/{{.Counter}}", "Go text/template of the MQTT topics with .Host .Node .Counter .Unit .Status")
+	flag.StringVar(&mqttClientID, "mqtt-client-id", "check_cisco_uc_perf", "MQTT client id")
+	flag.IntVar(&mqttQoS, "mqtt-qos", 0, "MQTT QoS level 0 or 1")
+	flag.StringVar(&esURL, "es-url", "http://localhost:9200", "Elasticsearch or OpenSearch URL")
+	flag.StringVar(&esIndex, "es-index", "cucm-perfmon-{date}", "Elasticsearch index, {date} is replaced with the UTC date YYYY.MM.DD")
+	flag.StringVar(&esUser, "es-user", "", "Elasticsearch username")
+	flag.StringVar(&esPassword, "es-password", "", "Elasticsearch password")
+	flag.StringVar(&esAPIKey, "es-api-key", "", "Elasticsearch API key, used instead of username and password")
+	flag.StringVar(&esCA, "es-ca", "", "CA certificate file to verify the Elasticsearch certificate")
+	flag.StringVar(&rrdDir, "rrd-dir", "/var/lib/check_cisco_uc_perf/rrd/", "Directory of the RRD files of -output rrd, one file per node and counter")
+	flag.IntVar(&rrdStep, "rrd-step", 300, "RRD step in seconds used when creating RRD files, the check interval")
+	flag.StringVar(&rrdtoolPath, "rrdtool", "rrdtool", "rrdtool command used to create and update the RRD files")
+	flag.StringVar(&kafkaBrokers, "kafka-brokers", "", "Publish the counter values as JSON messages to Kafka, comma separated bootstrap brokers host:port")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "cucm-perfmon", "Kafka topic of the counter value messages")
+	flag.BoolVar(&kafkaTLS, "kafka-tls", false, "connect to the Kafka brokers with TLS")
+	flag.StringVar(&kafkaCA, "kafka-ca", "", "CA certificate file to verify the Kafka broker certificates")
+	flag.StringVar(&kafkaSaslUser, "kafka-sasl-user", "", "Kafka SASL PLAIN username")
+	flag.StringVar(&kafkaSaslPassword, "kafka-sasl-password", "", "Kafka SASL PLAIN password")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the SOAP requests, full counter names, thresholds and cache files of the check without contacting the server")
 }
 
-func queryHost(ipAddr, nodeIpAddr, object, counterName, objectInstance string) {
+// result of a counter check on one node
+type checkResult struct {
+	node      string
+	returnVal int
+	text      string // plugin output without status and perfdata
+	label     string // perfdata label, empty if there is no perfdata
+	value     string
+	uom       string // perfdata unit of the value
+	warning   string
+	critical  string
+	notFound  bool
+	empty     bool // the response of the object had no counters at all
+
+	extraPerfdata []string      // additional perfdata entries
+	longOutput    []string      // lines following the status line
+	instances     []string      // instances of the object in the response
+	children      []childResult // child checks of -output-format
+}
 
-	fullCounterName := ""
+// make plugin output safe for nagios
+func escapeOutput(s string) string {
+	s = html.EscapeString(s)
+	s = strings.Replace(s, "%", "Percent", -1)
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return s
+}
 
-	debugPrintf(3, "queryHost CUCM IP address: %s Node IP address: %s\n", ipAddr, nodeIpAddr)
-	debugPrintf(3, "queryHost perfmon object: %s Counter name: %s\n", object, counterName)
-	debugPrintf(3, "queryHost counter instance name: %s max cache age: %d\n", objectInstance, maxCacheAge)
+// perfdata of a check result, labelPrefix qualifies the label e.g. with the cluster name
+func perfdataText(r *checkResult, labelPrefix string) string {
+	return fmt.Sprintf("%s%s=%s%s;%s;%s;;", labelPrefix, r.label, r.value, r.uom, r.warning, r.critical)
+}
 
-	counterEnvelope := new(CounterEnvelope)
-	loaded := loadStruct(nodeIpAddr, object, maxCacheAge, counterEnvelope)
-	if !loaded {
-		debugPrintf(3, "No persistence file found or persistence file too old\n")
-		usePersistData = false
-	} else {
-		debugPrintf(3, "Persistence file found: %+v\n", counterEnvelope)
-		if isFullQualified(counterName) {
-			fullCounterName = counterName
-		} else {
-			fullCounterName = fmt.Sprintf("\\\\%s\\%s\\%s", nodeIpAddr, object, counterName)
-		}
-		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
-			if v.Name.Text == fullCounterName {
-				debugPrintf(3, "Name: %s Value: %s\n", v.Name.Text, v.Value.Text)
-			}
-		}
-		usePersistData = true
+// qualify the perfdata labels of a result with a prefix, e.g. node/ in multi-node
+// checks so the graphs of the nodes don't overwrite each other
+func qualifyPerfdata(r *checkResult, labelPrefix string) {
+	if r.label != "" {
+		r.label = labelPrefix + r.label
 	}
+	for i, p := range r.extraPerfdata {
+		r.extraPerfdata[i] = labelPrefix + p
+	}
+}
 
-	debugPrintf(3, "use persistence: %v\n", usePersistData)
-	if !usePersistData || showCounters {
+// all perfdata entries of a result
+func resultPerfdata(r *checkResult) []string {
+	perfdata := r.extraPerfdata
+	if r.label != "" {
+		perfdata = append([]string{perfdataText(r, "")}, perfdata...)
+	}
+	return perfdata
+}
 
-		client := &http.Client{
+// plugin output of a check result: status line with perfdata and optional long output
+func formatResult(r *checkResult) string {
+	perfdata := resultPerfdata(r)
 
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-					MaxVersion:         tls.VersionTLS11,
-				},
-			},
+	if outputTmpl != nil {
+		s, err := renderTemplate(r, perfdata)
+		if err == nil {
+			return s
 		}
+		debugPrintf(1, "output template error: %s\n", err)
+	}
 
-		xml_header := []byte(`<?xml version="1.0" encoding="utf-8" ?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:soap="http://schemas.cisco.com/ast/soap"><soapenv:Header/><soapenv:Body>`)
-		xml_footer := []byte(`</soapenv:Body></soapenv:Envelope>`)
+	s := fmt.Sprintf("%s - %s", returnValText(r.returnVal), r.text)
+	if len(perfdata) > 0 {
+		s += "|" + strings.Join(perfdata, " ")
+	}
+	lines := []string{escapeOutput(s)}
+	longOutput := r.longOutput
+	if outputFormat != "" && len(r.children) > 0 {
+		longOutput = childOutput(r.children)
+	}
+	for _, line := range longOutput {
+		lines = append(lines, escapeOutput(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// print the plugin output of the final check result, track its state and
+// exit with the plugin return code. state changes are written to the event
+// log and sent as trap if configured.
+func exitWithResult(r *checkResult) {
+	// trend thresholds may raise the state, -warmup, -critical-cap and
+	// -unknown-as-ok apply to it
+	if historyEnabled || trendWarning != "" || trendCritical != "" {
+		if state := currentCheckState(); state != nil {
+			applyHistory(r, state)
+		}
+	}
+	applyWarmup(r)
+	downgradeResult(r)
+	// the state of the exit code, nothing below changes it
+	writeAudit(r)
+
+	if selfPerfdata {
+		if apiRequests > 0 {
+			r.extraPerfdata = append(r.extraPerfdata, fmt.Sprintf("api_rtt_ms=%d;;;;", (apiRoundTrip/time.Duration(apiRequests)).Milliseconds()))
+		}
+		r.extraPerfdata = append(r.extraPerfdata, fmt.Sprintf("plugin_runtime_ms=%d;;;;", time.Since(startTime).Milliseconds()))
+	}
 
-		xml_data := make([]byte, 32768)
+	publishMetrics(r)
 
-		if showCounters {
-			req_data := &PerfmonListCounter{Host: nodeIpAddr}
-			xml_data, _ = xml.Marshal(req_data)
+	if perfdataOnly {
+		perfdata := resultPerfdata(r)
+		if len(perfdata) == 0 {
+			fmt.Fprintf(os.Stderr, "%s - %s\n", returnValText(r.returnVal), r.text)
 		} else {
-			req_data := &PerfmonCollectCounterData{Host: nodeIpAddr, Object: object}
-			xml_data, _ = xml.Marshal(req_data)
+			fmt.Printf("%s\n", escapeOutput(strings.Join(perfdata, " ")))
+		}
+		if checkState != nil {
+			releaseState(checkState)
+		}
+		os.Exit(0)
+	}
+
+	if showCorrelationID {
+		r.longOutput = append(r.longOutput, "correlation ID: "+correlationID)
+	}
+	output := formatResult(r)
+	fmt.Printf("%s\n", output)
+
+	if !checkResultsWritten {
+		node := r.node
+		if node == "" {
+			node = nodeIpAddr
+		}
+		if err := submitResult(node, r); err != nil {
+			debugPrintf(1, "%s\n", err)
+		}
+	}
+
+	if state := currentCheckState(); state != nil {
+		if (state.exists && state.ReturnVal != r.returnVal) || (!state.exists && r.returnVal != 0) {
+			debugPrintf(3, "state change %s -> %s\n", returnValText(state.ReturnVal), returnValText(r.returnVal))
+			if eventLogFileName != "" {
+				if err := writeEvent(state.Key, state.ReturnVal, r.returnVal, r.value); err != nil {
+					debugPrintf(1, "event log error: %s\n", err)
+				}
+			}
+			if snmpTrapTarget != "" {
+				if err := sendSnmpTrap(state.Key, r.returnVal, state.ReturnVal, strings.SplitN(output, "\n", 2)[0]); err != nil {
+					debugPrintf(1, "SNMP trap error: %s\n", err)
+				}
+			}
 		}
 
-		buf_all := make([]byte, 32768)
+		state.ReturnVal, state.Value, state.Time = r.returnVal, r.value, time.Now().Unix()
+		if value, err := strconv.ParseFloat(r.value, 64); err == nil {
+			addStateSample(state, value, r.returnVal)
+		}
+		if err := saveState(state); err != nil {
+			debugPrintf(1, "state save error: %s\n", err)
+		}
+	}
 
-		buf_all = append(buf_all, xml_header...)
-		buf_all = append(buf_all, xml_data...)
-		buf_all = append(buf_all, xml_footer...)
+	pruneCacheOpportunistic()
+	os.Exit(r.returnVal)
+}
 
-		xml_all := fmt.Sprintf("%s%s%s", xml_header, xml_data, xml_footer)
+// soften the return code for planned maintenance with -unknown-as-ok and -critical-cap
+func downgradeResult(r *checkResult) {
+	if unknownAsOK && r.returnVal == 3 {
+		r.returnVal = 0
+		r.text += " (UNKNOWN as OK)"
+	}
+	if criticalCap == "warning" && r.returnVal == 2 {
+		r.returnVal = 1
+		r.text += " (CRITICAL capped to WARNING)"
+	}
+}
 
-		debugPrintf(3, "XML SOAP request: %s\n", xml_all)
+// returns the more severe of two plugin return codes (OK < UNKNOWN < WARNING < CRITICAL)
+func worseReturnVal(a, b int) int {
+	severity := map[int]int{0: 0, 3: 1, 1: 2, 2: 3}
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
 
-		data := bytes.NewBufferString(xml_all)
+// HTTPS client used for all requests to CUCM
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			TLSClientConfig: newTLSConfig(),
+		},
+	}
+}
 
-		url := "https://" + ipAddr + ":8443/perfmonservice/services/PerfmonPort"
-		debugPrintf(3, "URL: %s\n", url)
-		req, err := http.NewRequest("POST", url, data)
+// API endpoints of the comma separated -H list in failover order
+func apiHosts(hostList string) []string {
+	hosts := []string{}
+	for _, host := range strings.Split(hostList, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = append(hosts, "")
+	}
+	return hosts
+}
+
+// POST a SOAP request with basic auth or, with -oauth-token-url, a Bearer token.
+// session cookies are sent instead of basic auth.
+func postSOAP(client *http.Client, url, soapAction, request string, refreshToken bool, cookies []*http.Cookie) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString(request))
+	if err != nil {
+		return nil, err
+	}
+	// requests without SOAPAction are the JSON requests of -transport rest
+	if soapAction == "" {
+		req.Header.Add("Content-type", "application/json")
+		req.Header.Add("Accept", "application/json")
+	} else {
 		req.Header.Add("Content-type", "text/xml")
-		req.Header.Add("SOAPAction", "CUCM:DB ver="+apiVersion)
+		req.Header.Add("SOAPAction", soapAction)
+	}
+	req.Header.Set("X-Request-ID", requestCorrelationID())
+	if oauthTokenURL != "" {
+		token, err := bearerToken(refreshToken)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if len(cookies) > 0 {
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		debugPrintf(3, "reusing session cookies\n")
+	} else {
 		req.SetBasicAuth(username, password)
+		debugPrintf(3, "username: %s, password: %s\n", username, strings.Repeat("*", len(password)))
+	}
+	return client.Do(req)
+}
+
+// send a SOAP request to the first reachable host of the comma separated host list.
+// returns the response with the already read body and the host that answered.
+func soapRequest(hostList, urlPath, soapAction, request string) (*http.Response, []byte, string, error) {
+	defer correlateRequest()()
+	client := newHTTPClient()
+	var lastErr error
+
+	for _, host := range apiHosts(hostList) {
+		url := "https://" + host + ":8443" + urlPath
+		debugPrintf(3, "URL: %s\n", url)
 
-		debugPrintf(3, "username: %s, password: %s\n", username, password)
+		var cookies []*http.Cookie
+		if sessionReuse && oauthTokenURL == "" {
+			cookies = loadSession(host)
+		}
 
-		resp, err := client.Do(req)
+		requestStart := time.Now()
+		resp, err := postSOAP(client, url, soapAction, request, false, cookies)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && oauthTokenURL != "" {
+			resp.Body.Close()
+			debugPrintf(2, "Bearer token rejected by %s, requesting a new token\n", host)
+			resp, err = postSOAP(client, url, soapAction, request, true, nil)
+		}
+		if err == nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && len(cookies) > 0 {
+			resp.Body.Close()
+			debugPrintf(2, "session of %s rejected, falling back to basic auth\n", host)
+			dropSession(host)
+			resp, err = postSOAP(client, url, soapAction, request, false, nil)
+		}
+		if err == nil && sessionReuse && oauthTokenURL == "" && resp.StatusCode == http.StatusOK {
+			saveSession(host, resp)
+		}
 		if err != nil {
-			debugPrintf(1, "HTTPS request error: %s %#v\n", err, resp)
-			os.Exit(3)
+			debugPrintf(2, "HTTPS request error: %s %#v\n", err, resp)
+			lastErr = err
+			continue
 		}
 		defer resp.Body.Close()
+		if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			serverCertNotAfter = resp.TLS.PeerCertificates[0].NotAfter
+		}
 		body, _ := ioutil.ReadAll(resp.Body)
+		apiRoundTrip += time.Since(requestStart)
+		apiRequests++
+		debugPrintf(3, "X-Request-ID %s %s: %s, %d bytes in %s\n", requestCorrelationID(), url, resp.Status, len(body), time.Since(requestStart))
+		if recordDir != "" {
+			recordExchange(url, soapAction, request, resp.Status, body)
+		}
+		return resp, body, host, nil
+	}
 
-		debugPrintf(3, "XML SOAP response: %s\n", body)
+	debugPrintf(1, "HTTPS request error: %s\n", lastErr)
+	return nil, nil, "", lastErr
+}
 
-		if showCounters {
+// SOAP envelope of a PerfmonPort request
+func perfmonRequestXML(reqData interface{}) string {
+	xml_data, _ := xml.Marshal(reqData)
 
-			listCounterEnvelope := new(ListCounterEnvelope)
-			err = xml.Unmarshal([]byte(body), listCounterEnvelope)
-			if err != nil {
-				debugPrintf(1, "ListCounterEnvelope XML unmarshal error: %s\n", err)
-				os.Exit(3)
-			}
+	return soapEnvelope(string(xml_data))
+}
 
-			debugPrintf(3, "PerfmonListCounterData: %+v\n", listCounterEnvelope.Body)
+// send a PerfmonPort SOAP request. returns the response body and the failover text
+// if a host other than the first -H endpoint answered.
+func perfmonRequest(ipAddr string, reqData interface{}) ([]byte, string, error) {
+	xml_all := perfmonRequestXML(reqData)
 
-			fmt.Printf("%d items\n", len(listCounterEnvelope.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo))
+	debugPrintf(3, "XML SOAP request: %s\n", xml_all)
 
-			for _, v := range listCounterEnvelope.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo {
-				fmt.Printf("%v\n", v.Name.Text)
-				for _, c := range v.ArrayOfCounter.ArrayOfCounter {
-					fmt.Printf("\t%s\n", c.Name.Text)
-				}
-			}
+	if replayFile != "" {
+		body, err := replayResponse()
+		return body, "", err
+	}
+
+	_, body, usedHost, err := soapRequest(ipAddr, "/perfmonservice/services/PerfmonPort", perfmonSOAPAction(), xml_all)
+	if err != nil {
+		return nil, "", fmt.Errorf("HTTPS request error: %s", err)
+	}
+
+	debugPrintf(3, "XML SOAP response: %s\n", body)
 
-			os.Exit(0)
+	return body, failoverText(ipAddr, usedHost), nil
+}
+
+// output text if a host other than the first -H endpoint answered
+func failoverText(ipAddr, usedHost string) string {
+	if hosts := apiHosts(ipAddr); usedHost != hosts[0] {
+		return fmt.Sprintf(" (failover to %s, %s unreachable)", usedHost, hosts[0])
+	}
+	return ""
+}
+
+// print PerfmonListCounter of a node
+func listCounters(ipAddr, nodeIpAddr string) {
+	listCounterEnvelope, err := counterCatalog(ipAddr, nodeIpAddr)
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	debugPrintf(3, "PerfmonListCounterData: %+v\n", listCounterEnvelope.Body)
+
+	fmt.Printf("%d items\n", len(listCounterEnvelope.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo))
+
+	for _, v := range listCounterEnvelope.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo {
+		fmt.Printf("%v\n", v.Name.Text)
+		for _, c := range v.ArrayOfCounter.ArrayOfCounter {
+			fmt.Printf("\t%s\n", c.Name.Text)
+		}
+	}
+}
+
+// perfmonListCounter catalog of a node, cached with the -catalog-cache-age TTL
+func counterCatalog(ipAddr, nodeIpAddr string) (*ListCounterEnvelope, error) {
+	listCounterEnvelope := new(ListCounterEnvelope)
+	if replayFile == "" && catalogCacheAge > 0 && loadStruct(nodeIpAddr, "perfmonListCounter", catalogCacheAge, listCounterEnvelope) {
+		debugPrintf(3, "counter catalog cache file used\n")
+		return listCounterEnvelope, nil
+	}
+
+	if transport == "rest" {
+		listCounterEnvelope, err := restListCounter(ipAddr, nodeIpAddr)
+		if err == nil && catalogCacheAge > 0 {
+			saveStruct(nodeIpAddr, "perfmonListCounter", listCounterEnvelope)
 		}
+		return listCounterEnvelope, err
+	}
 
-		counterEnvelope = new(CounterEnvelope)
-		err = xml.Unmarshal([]byte(body), counterEnvelope)
-		if err != nil {
-			debugPrintf(1, "XML unmarshal error: %s\n", err)
-			os.Exit(3)
+	body, _, err := perfmonRequest(ipAddr, &PerfmonListCounter{Host: nodeIpAddr})
+	if err != nil {
+		return nil, err
+	}
+
+	err = xml.Unmarshal([]byte(body), listCounterEnvelope)
+	if err != nil {
+		debugPrintf(1, "ListCounterEnvelope XML unmarshal error: %s\n", err)
+		return nil, fmt.Errorf("ListCounterEnvelope XML unmarshal error: %s", err)
+	}
+	if replayFile == "" && catalogCacheAge > 0 {
+		saveStruct(nodeIpAddr, "perfmonListCounter", listCounterEnvelope)
+	}
+	return listCounterEnvelope, nil
+}
+
+// collect the counter data of a perfmon object on a node. the data is loaded from
+// the cache if not older than the maximum cache age, otherwise requested and cached.
+func collectCounterData(ipAddr, nodeIpAddr, object string) (*CounterEnvelope, string, error) {
+	defer correlateNode(nodeIpAddr)()
+	counterEnvelope := new(CounterEnvelope)
+	loaded := replayFile == "" && loadStruct(nodeIpAddr, object, objectCacheAge(object), counterEnvelope)
+	if !loaded {
+		debugPrintf(3, "No persistence file found or persistence file too old\n")
+		usePersistData = false
+	} else {
+		debugPrintf(3, "Persistence file found: %+v\n", counterEnvelope)
+		usePersistData = true
+	}
+
+	debugPrintf(3, "use persistence: %v\n", usePersistData)
+	if usePersistData {
+		return counterEnvelope, "", nil
+	}
+
+	return fetchCounterData(ipAddr, nodeIpAddr, object)
+}
+
+// request the counter data of a perfmon object on a node and save it to the cache
+func fetchCounterData(ipAddr, nodeIpAddr, object string) (*CounterEnvelope, string, error) {
+	if transport == "rest" {
+		counterEnvelope, failoverText, err := restCollectCounterData(ipAddr, nodeIpAddr, object)
+		if err == nil && replayFile == "" {
+			saveStruct(nodeIpAddr, object, counterEnvelope)
 		}
+		return counterEnvelope, failoverText, err
+	}
+
+	body, failoverText, err := perfmonRequest(ipAddr, &PerfmonCollectCounterData{Host: nodeIpAddr, Object: object})
+	if err != nil {
+		return nil, "", err
+	}
+
+	counterEnvelope := new(CounterEnvelope)
+	err = xml.Unmarshal([]byte(body), counterEnvelope)
+	if err != nil {
+		debugPrintf(1, "XML unmarshal error: %s\n", err)
+		return nil, "", fmt.Errorf("XML unmarshal error: %s", err)
+	}
+	if replayFile == "" {
 		saveStruct(nodeIpAddr, object, counterEnvelope)
+	}
 
+	return counterEnvelope, failoverText, nil
+}
+
+// perfmon object name: remove tailing instance names and parenthesis
+func perfmonObject(objectInstance string) string {
+	if pos := strings.Index(objectInstance, "("); pos != -1 {
+		return objectInstance[:pos]
 	}
+	return objectInstance
+}
 
-	if len(counterName) > 0 {
-		if isFullQualified(counterName) {
-			fullCounterName = counterName
-		} else {
-			fullCounterName = fmt.Sprintf("\\\\%s\\%s\\%s", nodeIpAddr, objectInstance, counterName)
+// correct the capitalization of the perfmon object of an object instance using
+// the counter catalog, the object names of the PerfmonPort requests are case sensitive
+func resolveObjectCase(ipAddr, nodeIpAddr, objectInstance string) string {
+	object := perfmonObject(objectInstance)
+	catalog, err := counterCatalog(ipAddr, nodeIpAddr)
+	if err != nil {
+		debugPrintf(1, "counter catalog error: %s\n", err)
+		return objectInstance
+	}
+	for _, o := range catalog.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo {
+		if o.Name.Text != object && strings.EqualFold(o.Name.Text, object) {
+			debugPrintf(3, "perfmon object %s resolved to %s\n", object, o.Name.Text)
+			return o.Name.Text + objectInstance[len(object):]
+		}
+	}
+	return objectInstance
+}
+
+// distinct object(instance) names of an object in a response
+func objectInstances(counterEnvelope *CounterEnvelope, nodeIpAddr, object string) []string {
+	instances := []string{}
+	seen := map[string]bool{}
+	prefix := "\\\\" + nodeIpAddr + "\\"
+	for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+		name := strings.TrimPrefix(v.Name.Text, prefix)
+		if pos := strings.LastIndex(name, "\\"); pos != -1 {
+			name = name[:pos]
+		}
+		if strings.HasPrefix(name, object) && !seen[name] && instanceAllowed(instanceOf(name+"\\")) {
+			seen[name] = true
+			instances = append(instances, name)
 		}
-		debugPrintf(3, "fullCounterName: >>%s<<\n", fullCounterName)
-		debugPrintf(3, "envelope.Body.perfmonCollectCounterDataResponse: %+v\n", counterEnvelope)
+	}
+	return instances
+}
 
-		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
-			if v.Name.Text == fullCounterName {
+// full qualified counter name \\node\object(instance)\counter
+func getFullCounterName(nodeIpAddr, objectInstance, counterName string) string {
+	if isFullQualified(counterName) {
+		return counterName
+	}
+	return fmt.Sprintf("\\\\%s\\%s\\%s", nodeIpAddr, objectInstance, counterName)
+}
 
-				value, err := strconv.ParseFloat(v.Value.Text, 64)
-				if err != nil {
-					debugPrintf(1, "Counter value string to float64 convert error: %s\n", err)
-					os.Exit(3)
-				}
-				returnVal = getNagiosReturnVal(value, warningThreshold, criticalThreshold)
-				debugPrintf(3, "returnVal: %d\n", returnVal)
-				statusStr := returnValText(returnVal)
-
-				nagiosOutput := fmt.Sprintf("%s - %s,%s,%s=%s|%s=%s;%s;%s;;", statusStr, outputPrefix, objectInstance, counterName, v.Value.Text, counterName, v.Value.Text, warningThreshold, criticalThreshold)
-				nagiosOutput = html.EscapeString(nagiosOutput)
-				nagiosOutput = strings.Replace(nagiosOutput, "%", "Percent", -1)
-				nagiosOutput = strings.Replace(nagiosOutput, "\\", "\\\\", -1)
-				fmt.Printf("%s\n", nagiosOutput)
-				os.Exit(returnVal)
+// counter value as displayed and in perfdata: rounded to -precision decimal
+// places and without trailing zeros, e.g. 12 instead of 12.000000
+func counterValueText(text string) string {
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return text
+	}
+	if precision >= 0 {
+		value, _ = strconv.ParseFloat(strconv.FormatFloat(value, 'f', precision, 64), 64)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// text of a response without any counter, e.g. of an object without instances,
+// in contrast to a counter missing in a response with other counters
+func emptyCounterDataText(nodes []string, object string) string {
+	where := "node " + strings.Join(nodes, "")
+	if len(nodes) > 1 {
+		where = "nodes " + strings.Join(nodes, ", ")
+	}
+	return fmt.Sprintf("No counters returned for %s on %s: the object has no instances (e.g. no trunks or no service activated) or the user lacks the Standard RealtimeAndTraceCollection role", object, where)
+}
+
+// value of a full qualified counter in the collected counter data
+func findCounterValue(counterEnvelope *CounterEnvelope, fullCounterName string) (string, bool) {
+	for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+		if v.Name.Text == fullCounterName {
+			return counterValueText(v.Value.Text), true
+		}
+	}
+	if ignoreCase {
+		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+			if strings.EqualFold(v.Name.Text, fullCounterName) {
+				debugPrintf(3, "counter %s matched case-insensitive: %s\n", fullCounterName, v.Name.Text)
+				return counterValueText(v.Value.Text), true
 			}
 		}
-		returnVal := 3
-		statusStr := returnValText(returnVal)
-		if multipeNodes {
-			debugPrintf(3, "%s - Counter not found: %s\n", statusStr, fullCounterName)
-		} else {
-			fmt.Printf("%s - Counter not found: %s\n", statusStr, fullCounterName)
-			os.Exit(returnVal)
+	}
+	return "", false
+}
+
+// query a perfmon counter of a node. returns nil if no counter name is given.
+func queryHost(ipAddr, nodeIpAddr, object, counterName, objectInstance string) *checkResult {
+	defer correlateNode(nodeIpAddr)()
+
+	serverCertNotAfter = time.Time{}
+
+	debugPrintf(3, "queryHost CUCM IP address: %s Node IP address: %s\n", ipAddr, nodeIpAddr)
+	debugPrintf(3, "queryHost perfmon object: %s Counter name: %s\n", object, counterName)
+	debugPrintf(3, "queryHost counter instance name: %s max cache age: %d\n", objectInstance, objectCacheAge(perfmonObject(objectInstance)))
+
+	counterEnvelope, failoverText, err := collectCounterData(ipAddr, nodeIpAddr, object)
+	if err != nil {
+		return &checkResult{node: nodeIpAddr, returnVal: 3, text: err.Error()}
+	}
+
+	if len(counterName) == 0 {
+		return nil
+	}
+
+	if len(counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo) == 0 {
+		debugPrintf(2, "empty ArrayOfCounterInfo of %s on %s\n", object, nodeIpAddr)
+		return &checkResult{node: nodeIpAddr, returnVal: 3, text: emptyCounterDataText([]string{nodeIpAddr}, object), notFound: true, empty: true}
+	}
+
+	if instances := listedInstances(objectInstance); instances != nil {
+		return queryInstances(counterEnvelope, nodeIpAddr, object, counterName, instances, failoverText)
+	}
+
+	fullCounterName := getFullCounterName(nodeIpAddr, objectInstance, counterName)
+	debugPrintf(3, "fullCounterName: >>%s<<\n", fullCounterName)
+	debugPrintf(3, "envelope.Body.perfmonCollectCounterDataResponse: %+v\n", counterEnvelope)
+
+	valueText, found := findCounterValue(counterEnvelope, fullCounterName)
+	if !found {
+		debugPrintf(3, "%s - Counter not found: %s\n", returnValText(3), fullCounterName)
+		text := fmt.Sprintf("Counter not found: %s", fullCounterName)
+		if suggestions := suggestCounters(fullCounterName, counterCandidates(counterEnvelope, nodeIpAddr, objectInstance)); len(suggestions) > 0 {
+			text += fmt.Sprintf(", did you mean %s?", strings.Join(suggestions, " or "))
+		}
+		return &checkResult{node: nodeIpAddr, returnVal: 3, text: text, notFound: true}
+	}
+
+	if invalidValue(valueText) {
+		text := fmt.Sprintf("%s,%s,%s=%s (not available)%s", outputPrefix, objectInstance, counterName, valueText, failoverText)
+		r := &checkResult{node: nodeIpAddr, returnVal: invalidValueReturnVal(), text: text, label: counterName, value: "U"}
+		if invalidValueAs == "skip" {
+			r.text, r.label, r.notFound = text+", skipped", "", true
+		}
+		return r
+	}
+
+	value, err := strconv.ParseFloat(valueText, 64)
+	if err != nil {
+		debugPrintf(1, "Counter value string to float64 convert error: %s\n", err)
+		return &checkResult{node: nodeIpAddr, returnVal: 3, text: fmt.Sprintf("Counter value string to float64 convert error: %s", err)}
+	}
+	if scaleFactor != 1 {
+		value *= scaleFactor
+		valueText = counterValueText(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	warning, critical := thresholdsForNode(nodeIpAddr)
+	if len(expectedValues()) > 0 {
+		warning, critical = "", ""
+	}
+
+	// with -capacity-counter the thresholds are percent of the capacity
+	label, capacityText, rawValueText := counterName, "", valueText
+	var extraPerfdata []string
+	if capacityCounter != "" {
+		percent, capacity, err := capacityPercent(counterEnvelope, nodeIpAddr, objectInstance, value)
+		if err != nil {
+			return &checkResult{node: nodeIpAddr, returnVal: 3, text: err.Error()}
+		}
+		extraPerfdata = []string{fmt.Sprintf("%s=%s;;;0;%s", counterName, valueText, capacity)}
+		capacityText = fmt.Sprintf(" (%.1f%% of %s %s)", percent, capacityCounter, capacity)
+		value, valueText, label = percent, strconv.FormatFloat(percent, 'f', 1, 64), counterName+"_pct"
+	}
+
+	// with -convert the thresholds are in the converted unit
+	uom := ""
+	if convertUnit != "" {
+		conversion, err := valueConversionOf(convertUnit)
+		if err != nil {
+			return &checkResult{node: nodeIpAddr, returnVal: 3, text: err.Error()}
+		}
+		value *= conversion.factor
+		valueText, uom = counterValueText(strconv.FormatFloat(value, 'f', -1, 64)), conversion.uom
+		rawValueText = valueText + uom
+	}
+
+	returnVal := evaluateValue(value, warning, critical)
+	rawValueText += expectText(value, returnVal)
+	debugPrintf(3, "returnVal: %d\n", returnVal)
+	certText := ""
+	if warnCertDays > 0 {
+		if certText = certExpiryText(ipAddr); certText != "" && returnVal < 1 {
+			returnVal = 1
 		}
+	}
+
+	if allPerfdata {
+		extraPerfdata = append(extraPerfdata, objectPerfdata(counterEnvelope, nodeIpAddr, object, fullCounterName)...)
+	}
 
+	var longOutput []string
+	if topInstances > 0 {
+		longOutput = append(longOutput, topInstancesText(counterEnvelope, nodeIpAddr, object, counterName, topInstances)...)
+	}
+	if nearThresholdPercent > 0 {
+		if line := nearThresholdText(objectInstance+"\\"+label, valueText, value, returnVal, warning, critical); line != "" {
+			longOutput = append(longOutput, line)
+		}
+		// raw values of the other instances only match unconverted thresholds
+		if capacityCounter == "" && convertUnit == "" && scaleFactor == 1 {
+			longOutput = append(longOutput, nearThresholdInstancesText(counterEnvelope, nodeIpAddr, object, counterName, objectInstance, warning, critical)...)
+		}
+	}
+	if describeCounters {
+		if description := counterDescriptionText(ipAddr, nodeIpAddr, fullCounterName); description != "" {
+			longOutput = append(longOutput, description)
+		}
 	}
 
+	return &checkResult{
+		node:          nodeIpAddr,
+		returnVal:     returnVal,
+		text:          fmt.Sprintf("%s,%s,%s=%s%s%s%s", outputPrefix, objectInstance, counterName, rawValueText, capacityText, failoverText, certText),
+		instances:     objectInstances(counterEnvelope, nodeIpAddr, object),
+		label:         label,
+		value:         valueText,
+		uom:           uom,
+		warning:       warning,
+		critical:      critical,
+		extraPerfdata: extraPerfdata,
+		longOutput:    longOutput,
+	}
 }
 
-func main() {
+// usage error of missing required flags, empty if all are given. a replay
+// needs no server, a dry run and OAuth2 client credentials no -u and -p.
+func requiredFlagsError() string {
+	clusters := clusterList != "" || clustersFile != ""
+	switch {
+	case replayFile != "":
+		return ""
+	case ipAddr == "" && !clusters:
+		return "no CUCM server given, use -H publisher[,fallback...]"
+	case dryRun || clusters || (oauthTokenURL != "" && oauthGrant == "client_credentials"):
+		return ""
+	case username == "" && password == "":
+		return "no credentials given, use -u username -p password of an application user with the Standard CCM Admin Users and Standard RealtimeAndTraceCollection roles"
+	case username == "":
+		return "no username given, use -u"
+	case password == "":
+		return "no password given, use -p"
+	}
+	return ""
+}
 
-	flag.Parse()
+func main() {
 
-	logfile, err := os.OpenFile(logFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		debugPrintf(1, fmt.Sprintf("Can't open log file: %s\n", logFileName))
-		os.Exit(3)
+	startTime = time.Now()
+	parseCommandLine()
+	if correlationID == "" {
+		correlationID = newCorrelationID()
 	}
 
-	defer logfile.Close()
+	// file logging is opt-in with -L, an unwritable log file doesn't fail the check
+	var logfile io.Writer
+	if logFileName != "" {
+		f, err := os.OpenFile(logFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't open log file, logging to stderr: %s\n", err)
+		} else {
+			defer f.Close()
+			logfile = f
+		}
+	}
 
 	returnVal = 3
 	multipeNodes = false
 	usePersistData = false
 
-	if showVersion {
-		fmt.Printf("%s version: %s\n", path.Base(os.Args[0]), version)
+	if showVersion || versionJSON {
+		printVersion()
 		os.Exit(0)
 	}
 
-	log.SetOutput(os.Stdout)
+	if err := setupTLS(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
 
-	// log.SetOutput(logfile)
+	if serverURL != "" {
+		os.Exit(runOnServer())
+	}
 
-	// remove tailing instance names and parenthesis
-	object := ""
-	if pos := strings.Index(objectInstance, "("); pos != -1 {
-		object = objectInstance[:pos]
-	} else {
-		object = objectInstance
+	// never log to stdout, it is reserved for the plugin output parsed by nagios
+	addSecret(username, password)
+	addSecret(oauthClientID, oauthClientSecret)
+	addSecret(icinga2User, icinga2Password)
+	addSecret(kafkaSaslUser, kafkaSaslPassword)
+	addSecret(mqttUser, mqttPassword)
+	addSecret(esUser, esPassword)
+	addSecret("", esAPIKey)
+	addSecret(snmpUser, snmpAuthPass)
+	addSecret("", cmrSFTPPassword)
+	addSecret(snmpUser, snmpPrivPass)
+	addSecret("", serveToken)
+	if snmpTrapTarget != "" {
+		addSecret("", snmpCommunity)
+	}
+	switch {
+	case logfile == nil && (debug > 0 || logFileName != ""):
+		log.SetOutput(redactWriter{os.Stderr})
+	case logfile == nil:
+		log.SetOutput(ioutil.Discard)
+	case debug > 0:
+		log.SetOutput(redactWriter{io.MultiWriter(logfile, os.Stderr)})
+	default:
+		log.SetOutput(redactWriter{logfile})
 	}
 
-	nodes := strings.Split(nodesIpAddrs, ",")
+	if checkUpdate {
+		debugPrintf(1, "%s\n", updateText())
+	}
 
-	if len(nodes) > 1 {
+	if err := checkExpect(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if err := checkOutputFormat(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if instanceSort != "" && instanceSort != "value" && instanceSort != "name" {
+		fmt.Printf("%s - unknown -sort: %s, use value or name\n", returnValText(3), instanceSort)
+		os.Exit(3)
+	}
+
+	switch command {
+	case "daemon":
+		os.Exit(serve())
+	case "cache":
+		os.Exit(runCacheCommand(commandArgs))
+	}
+
+	if text := requiredFlagsError(); text != "" {
+		help := filepath.Base(os.Args[0])
+		if command != "check" {
+			help += " " + command
+		}
+		fmt.Printf("%s - %s, see %s -h\n", returnValText(3), text, help)
+		os.Exit(3)
+	}
+
+	// a single node is usually the -H server itself
+	if nodeIpAddr == "" && ipAddr != "" {
+		nodeIpAddr = apiHosts(ipAddr)[0]
+	}
+
+	if criticalCap != "" && criticalCap != "warning" {
+		fmt.Printf("%s - unknown -critical-cap: %s, only warning is supported\n", returnValText(3), criticalCap)
+		os.Exit(3)
+	}
+
+	if err := checkInvalidValueAs(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if scaleFactor == 0 {
+		fmt.Printf("%s - -scale must not be 0\n", returnValText(3))
+		os.Exit(3)
+	}
+
+	if capacityCounter != "" && listedInstances(objectInstance) != nil {
+		fmt.Printf("%s - -capacity-counter can't be combined with an instance list in -o\n", returnValText(3))
+		os.Exit(3)
+	}
+
+	if convertUnit != "" {
+		if _, err := valueConversionOf(convertUnit); err != nil {
+			fmt.Printf("%s - %s\n", returnValText(3), err)
+			os.Exit(3)
+		}
+		if capacityCounter != "" {
+			fmt.Printf("%s - -convert can't be combined with -capacity-counter\n", returnValText(3))
+			os.Exit(3)
+		}
+	}
+
+	if transport != "soap" && transport != "rest" {
+		fmt.Printf("%s - unknown transport: %s\n", returnValText(3), transport)
+		os.Exit(3)
+	}
+
+	if err := checkMetricsOutputs(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if outputTemplateText != "" {
+		if err := parseOutputTemplate(outputTemplateText); err != nil {
+			fmt.Printf("%s - %s\n", returnValText(3), err)
+			os.Exit(3)
+		}
+	}
+
+	if err := applyProduct(); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if instanceName != "" {
+		if strings.Contains(objectInstance, "(") {
+			fmt.Printf("%s - -i can't be combined with an instance in -o %s\n", returnValText(3), objectInstance)
+			os.Exit(3)
+		}
+		objectInstance = objectInstance + "(" + instanceName + ")"
+	}
+
+	switch command {
+	case "discover":
+		os.Exit(runDiscover())
+	case "describe":
+		os.Exit(runDescribe())
+	}
+
+	object := perfmonObject(objectInstance)
+
+	nodes, err := getNodes()
+	if err != nil {
+		fmt.Printf("%s - Can't read node list file: %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+	if allNodes && !dryRun {
+		nodes, err = discoverNodes(ipAddr)
+		if err != nil {
+			fmt.Printf("%s - AXL node discovery failed: %s\n", returnValText(3), err)
+			os.Exit(3)
+		}
+	}
+
+	if len(nodes) > 1 || ((allNodes || strings.HasPrefix(nodesIpAddrs, "@")) && len(nodes) > 0) {
 		multipeNodes = true
 		debugPrintf(3, "multiple nodes: %v\n", nodes)
 	}
 
 	debugPrintf(3, "use multipe nodes: %v\n", multipeNodes)
 
-	if multipeNodes {
-		for _, nodeIpAddr = range nodes {
-			queryHost(ipAddr, nodeIpAddr, object, counterName, objectInstance)
+	if ignoreCase && objectInstance != "" && !dryRun && replayFile == "" {
+		catalogNode := nodeIpAddr
+		if multipeNodes {
+			catalogNode = nodes[0]
 		}
-	} else {
-		queryHost(ipAddr, nodeIpAddr, object, counterName, objectInstance)
+		objectInstance = resolveObjectCase(ipAddr, catalogNode, objectInstance)
+		object = perfmonObject(objectInstance)
 	}
 
-}
+	if healthCheck {
+		checkMode = "health"
+	}
+	if rtmtAlertList != "" {
+		checkMode = "rtmt"
+	}
+
+	if err := applyTimeThresholds(time.Now()); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	objectCacheAges, err = parseCacheAges(cacheAgeList)
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	nodeThresholds, err = parseNodeThresholds(nodeThresholdList)
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	clusters, err := getClusters()
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+
+	if dryRun {
+		if !multipeNodes {
+			nodes = []string{nodeIpAddr}
+		}
+		lines, err := dryRunLines(nodes, clusters, object)
+		if err != nil {
+			fmt.Printf("%s - dry run: %s\n", returnValText(3), err)
+			os.Exit(3)
+		}
+		fmt.Printf("%s - dry run, no request sent\n%s\n", returnValText(0), strings.Join(lines, "\n"))
+		os.Exit(0)
+	}
 
+	if len(clusters) > 0 {
+		exitWithResult(checkClusters(clusters, object))
+	}
+
+	if prefetchObjects != "" {
+		if !multipeNodes {
+			nodes = []string{nodeIpAddr}
+		}
+		os.Exit(prefetch(nodes))
+	}
+
+	if benchCount > 0 {
+		r := runBench(benchCount)
+		fmt.Println(formatResult(r))
+		os.Exit(r.returnVal)
+	}
+
+	if !multipeNodes {
+		nodes = []string{nodeIpAddr}
+	}
+	if showCounters {
+		listCounters(ipAddr, nodes[0])
+		os.Exit(0)
+	}
+	if checkMode != "" {
+		mode, ok := checkModes[checkMode]
+		if !ok {
+			fmt.Printf("%s - unknown mode: %s\n", returnValText(3), checkMode)
+			os.Exit(3)
+		}
+		exitWithResult(mode.check(nodes, object))
+	}
+
+	if counterName == "" && thresholdsFile != "" {
+		exitWithResult(checkObject(nodes, object))
+	}
+
+	if multipeNodes && nodeAggregate != "" {
+		exitWithResult(aggregateNodes(nodes, object))
+	}
+
+	if multipeNodes && (checkResultsDir != "" || icinga2API != "") && strings.Contains(checkResultService, "{node}") {
+		exitWithResult(submitNodeResults(nodes, object))
+	}
+
+	if multipeNodes && len(counterName) > 0 {
+		exitWithResult(checkNodes(nodes, object))
+	}
+	if r := queryHost(ipAddr, nodeIpAddr, object, counterName, objectInstance); r != nil {
+		exitWithResult(r)
+	}
+
+	exitWithResult(&checkResult{returnVal: 3, text: "no counter name given, use -n"})
+}
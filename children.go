@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+)
+
+// child check of a composite result, e.g. a node of -M, a cluster of -clusters
+// or a counter of -thresholds-file
+type childResult struct {
+	name       string
+	returnVal  int
+	text       string
+	longOutput []string
+}
+
+// long output of the child checks for -output-format: check_multi
+// "[ 1] name STATE - text" or "[STATE] name: text" lines with the state tag
+// colored by Icinga Web. the long output of a child follows its line.
+func childOutput(children []childResult) []string {
+	lines := []string{}
+	for i, c := range children {
+		switch outputFormat {
+		case "multi":
+			lines = append(lines, fmt.Sprintf("[%2d] %s %s - %s", i+1, c.name, returnValText(c.returnVal), c.text))
+			lines = append(lines, c.longOutput...)
+		case "icinga":
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s", returnValText(c.returnVal), c.name, c.text))
+			for _, line := range c.longOutput {
+				lines = append(lines, "   "+line)
+			}
+		}
+	}
+	return lines
+}
+
+// validate -output-format
+func checkOutputFormat() error {
+	switch outputFormat {
+	case "", "multi", "icinga":
+		return nil
+	}
+	return fmt.Errorf("unknown -output-format: %s, use multi or icinga", outputFormat)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CUCM cluster queried in multi-cluster mode
+type cluster struct {
+	host     string
+	username string
+	password string
+}
+
+// build the cluster list from -clusters and -clusters-file.
+// clusters without own credentials use -u and -p. the host of a clusters file
+// entry may be a comma separated list of API endpoints like -H.
+func getClusters() ([]cluster, error) {
+	clusters := []cluster{}
+
+	if clusterList != "" {
+		for _, host := range strings.Split(clusterList, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				clusters = append(clusters, cluster{host: host, username: username, password: password})
+			}
+		}
+	}
+
+	if clustersFile != "" {
+		lines, err := readListFile(clustersFile)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read clusters file: %s", err)
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			c := cluster{host: fields[0], username: username, password: password}
+			if len(fields) > 1 {
+				c.username = fields[1]
+			}
+			if len(fields) > 2 {
+				c.password = fields[2]
+				addSecret(c.username, c.password)
+			}
+			clusters = append(clusters, c)
+		}
+	}
+
+	return clusters, nil
+}
+
+// run the check, or the -mode, against the publisher of every cluster and
+// combine the results to one output with a section per cluster and the most
+// severe return code
+func checkClusters(clusters []cluster, object string) *checkResult {
+	var mode checkModeFuncs
+	if checkMode != "" {
+		var ok bool
+		if mode, ok = checkModes[checkMode]; !ok {
+			return &checkResult{returnVal: 3, text: fmt.Sprintf("unknown mode: %s", checkMode)}
+		}
+		// one state of the clusters check, the modes key their data by node
+		currentCheckState()
+	}
+
+	combinedReturnVal := 0
+	stateCount := map[int]int{}
+	perfdata := []string{}
+	sections := []string{}
+	children := []childResult{}
+
+	// the requests and modes use the global server and credentials, restore
+	// -H, -N, -u and -p afterwards for the event log, traps and submissions
+	defer func(h, n, u, p string) { ipAddr, nodeIpAddr, username, password = h, n, u, p }(ipAddr, nodeIpAddr, username, password)
+	for _, c := range clusters {
+		username, password = c.username, c.password
+		name := apiHosts(c.host)[0]
+		var r *checkResult
+		if mode.check != nil {
+			ipAddr, nodeIpAddr = c.host, name
+			r = mode.check([]string{name}, object)
+		} else {
+			r = queryHost(c.host, name, object, counterName, objectInstance)
+		}
+		if r == nil {
+			r = &checkResult{node: name, returnVal: 3, text: "no counter name given"}
+		}
+		debugPrintf(3, "cluster %s returnVal: %d\n", name, r.returnVal)
+
+		combinedReturnVal = worseReturnVal(combinedReturnVal, r.returnVal)
+		stateCount[r.returnVal]++
+		qualifyPerfdata(r, name+"/")
+		perfdata = append(perfdata, resultPerfdata(r)...)
+		sections = append(sections, fmt.Sprintf("%s: %s - %s", name, returnValText(r.returnVal), r.text))
+		children = append(children, childResult{name: name, returnVal: r.returnVal, text: r.text, longOutput: r.longOutput})
+	}
+
+	summary := []string{}
+	for _, rv := range []int{0, 1, 2, 3} {
+		if stateCount[rv] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", stateCount[rv], returnValText(rv)))
+		}
+	}
+
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %d clusters: %s", outputPrefix, len(clusters), strings.Join(summary, ", ")),
+		extraPerfdata: perfdata,
+		longOutput:    sections,
+		children:      children,
+	}
+}
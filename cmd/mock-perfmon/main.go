@@ -0,0 +1,226 @@
+// 	file: cmd/mock-perfmon/main.go
+//
+// mock-perfmon is a PerfmonPort SOAP server serving recorded fixtures over HTTPS
+// with basic auth. it replaces a real CUCM for integration tests, demos and the
+// development of new output backends.
+//
+// fixtures:
+//		request/response pairs saved by check_cisco_uc_perf -record dir/ are
+//		answered for identical request bodies.
+//		<object>.xml files (e.g. "Memory.xml", "Cisco CallManager.xml") answer
+//		perfmonCollectCounterData of that object for any node, perfmonListCounter.xml
+//		answers perfmonListCounter and axl.xml all AXL requests.
+//
+// usage:
+//		mock-perfmon -d fixtures/ -listen :8443 -u admin -p secret
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fixture struct {
+	status int
+	body   []byte
+	file   string
+}
+
+var (
+	fixtureDir  string
+	listenAddr  string
+	username    string
+	password    string
+	certFile    string
+	keyFile     string
+	showVersion bool
+	debug       bool
+
+	// recorded responses by request body
+	recorded = map[string]fixture{}
+	// responses by perfmon object or operation
+	named = map[string]fixture{}
+
+	version = "0.1"
+
+	soapElementRe = regexp.MustCompile(`<(?:soap:)?(Object|Host)>([^<]*)</(?:soap:)?`)
+	statusRe      = regexp.MustCompile(`(?m)^# response: (\d+)`)
+)
+
+func init() {
+	flag.StringVar(&fixtureDir, "d", ".", "fixture directory")
+	flag.StringVar(&listenAddr, "listen", ":8443", "HTTPS listen address")
+	flag.StringVar(&username, "u", "admin", "basic auth username")
+	flag.StringVar(&password, "p", "admin", "basic auth password")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file, a self signed certificate is generated if empty")
+	flag.StringVar(&keyFile, "key", "", "TLS key file")
+	flag.BoolVar(&showVersion, "V", false, "print version")
+	flag.BoolVar(&debug, "debug", false, "log requests and matched fixtures")
+}
+
+// normalized request body used to match recorded requests
+func requestKey(body string) string {
+	return strings.Join(strings.Fields(body), " ")
+}
+
+// load recorded request/response pairs and named fixtures
+func loadFixtures(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		filename := filepath.Join(dir, name)
+		switch {
+		case strings.HasSuffix(name, "_request.txt"):
+			request, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			responseFile := strings.TrimSuffix(filename, "_request.txt") + "_response.xml"
+			body, err := ioutil.ReadFile(responseFile)
+			if err != nil {
+				return err
+			}
+			f := fixture{status: http.StatusOK, body: body, file: responseFile}
+			if m := statusRe.FindSubmatch(request); m != nil {
+				f.status, _ = strconv.Atoi(string(m[1]))
+			}
+			parts := strings.SplitN(string(request), "\n\n", 2)
+			if len(parts) == 2 {
+				recorded[requestKey(parts[1])] = f
+			}
+		case strings.HasSuffix(name, "_response.xml"):
+		case strings.HasSuffix(name, ".xml"):
+			body, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			named[strings.TrimSuffix(name, ".xml")] = fixture{status: http.StatusOK, body: body, file: filename}
+		}
+	}
+	log.Printf("%d recorded and %d named fixtures loaded from %s\n", len(recorded), len(named), dir)
+	return nil
+}
+
+// find the fixture answering a request
+func findFixture(urlPath, body string) (fixture, bool) {
+	if f, ok := recorded[requestKey(body)]; ok {
+		return f, true
+	}
+	if strings.HasPrefix(urlPath, "/axl") {
+		f, ok := named["axl"]
+		return f, ok
+	}
+	if strings.Contains(body, "perfmonListCounter") {
+		f, ok := named["perfmonListCounter"]
+		return f, ok
+	}
+	for _, m := range soapElementRe.FindAllStringSubmatch(body, -1) {
+		if m[1] == "Object" {
+			f, ok := named[m[2]]
+			return f, ok
+		}
+	}
+	return fixture{}, false
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	u, p, ok := r.BasicAuth()
+	if !ok || u != username || p != password {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mock-perfmon"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+
+	f, ok := findFixture(r.URL.Path, string(body))
+	if !ok {
+		if debug {
+			log.Printf("%s %s: no fixture for %s\n", r.RemoteAddr, r.URL.Path, body)
+		}
+		w.Header().Set("Content-type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>mock-perfmon: no fixture for request</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+		return
+	}
+	if debug {
+		log.Printf("%s %s: %s\n", r.RemoteAddr, r.URL.Path, f.file)
+	}
+	w.Header().Set("Content-type", "text/xml")
+	w.WriteHeader(f.status)
+	w.Write(f.body)
+}
+
+// self signed certificate for localhost and the listen address
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "mock-perfmon"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if showVersion {
+		fmt.Printf("%s version: %s\n", filepath.Base(os.Args[0]), version)
+		os.Exit(0)
+	}
+
+	if err := loadFixtures(fixtureDir); err != nil {
+		log.Fatalf("Can't load fixtures: %s\n", err)
+	}
+
+	var cert tls.Certificate
+	var err error
+	if certFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		cert, err = selfSignedCert()
+	}
+	if err != nil {
+		log.Fatalf("TLS certificate error: %s\n", err)
+	}
+
+	server := &http.Server{
+		Addr:    listenAddr,
+		Handler: http.HandlerFunc(handler),
+		// check_cisco_uc_perf limits the TLS version to 1.1 for older CUCM versions
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS10},
+	}
+	log.Printf("listening on %s\n", listenAddr)
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CDRonDemand service of the CDR repository node, usually the publisher
+	cdrOnDemandPath = "/CDRonDemandService2/services/CDRonDemandService"
+	// maximum interval of a get_file_list request
+	cdrOnDemandMaxInterval = time.Hour
+	// default thresholds of -mode call-quality
+	defaultQualityThresholds = "mos_avg=3.6:,3.1:;jitter_p95=30,60;loss_avg=1,3"
+)
+
+// CDRonDemand get_file_list response
+type CDROnDemandEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		GetFileListResponse struct {
+			Return struct {
+				Items []struct {
+					Text string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"get_file_listReturn"`
+		} `xml:"get_file_listResponse"`
+		Fault struct {
+			Faultstring string `xml:"faultstring"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// voice quality of a call leg from a CMR record
+type cmrRecord struct {
+	mos     float64 // MLQKav, 0 if the endpoint doesn't compute it
+	jitter  float64 // ms
+	latency float64 // ms
+	loss    float64 // percent of the received and lost packets
+}
+
+// CDRonDemand times are UTC minutes
+func cdrOnDemandTime(t time.Time) string {
+	return t.UTC().Format("200601021504")
+}
+
+// get_file_list request of the CDR and CMR files of an interval up to an hour
+func getFileListXML(from, to time.Time) string {
+	return soapEnvelope(fmt.Sprintf(`<soap:get_file_list><soap:in0>%s</soap:in0><soap:in1>%s</soap:in1><soap:in2>true</soap:in2></soap:get_file_list>`, cdrOnDemandTime(from), cdrOnDemandTime(to)))
+}
+
+// get_file request sending a file to the -cmr-sftp user@host:directory by SFTP
+func getFileXML(file string) string {
+	user, host, dir := cmrSFTPDestination()
+	return soapEnvelope(fmt.Sprintf(`<soap:get_file><soap:in0>%s</soap:in0><soap:in1>%s</soap:in1><soap:in2>%s</soap:in2><soap:in3>%s</soap:in3><soap:in4>%s</soap:in4><soap:in5>true</soap:in5></soap:get_file>`,
+		html.EscapeString(host), html.EscapeString(user), html.EscapeString(cmrSFTPPassword), html.EscapeString(dir), html.EscapeString(file)))
+}
+
+// user, host and directory of -cmr-sftp user@host:directory
+func cmrSFTPDestination() (string, string, string) {
+	user, hostDir := "", cmrSFTP
+	if i := strings.Index(hostDir, "@"); i >= 0 {
+		user, hostDir = hostDir[:i], hostDir[i+1:]
+	}
+	host, dir := hostDir, ""
+	if i := strings.Index(hostDir, ":"); i >= 0 {
+		host, dir = hostDir[:i], hostDir[i+1:]
+	}
+	return user, host, dir
+}
+
+// send a CDRonDemand request and check for faults
+func cdrOnDemandRequest(operation, request string) ([]byte, error) {
+	debugPrintf(3, "CDRonDemand SOAP request: %s\n", redact(request))
+	resp, body, _, err := soapRequest(ipAddr, cdrOnDemandPath, operation, request)
+	if err != nil {
+		return nil, fmt.Errorf("HTTPS request error: %s", err)
+	}
+	debugPrintf(3, "CDRonDemand SOAP response: %s\n", body)
+
+	envelope := new(CDROnDemandEnvelope)
+	err = xml.Unmarshal(body, envelope)
+	if envelope.Body.Fault.Faultstring != "" {
+		return nil, fmt.Errorf("CDRonDemand fault: %s", envelope.Body.Fault.Faultstring)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CDRonDemand HTTP status: %s", resp.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CDRonDemand XML unmarshal error: %s", err)
+	}
+	return body, nil
+}
+
+// request the CMR files of the interval not yet in -cmr-dir from CDRonDemand,
+// which sends them to the -cmr-sftp destination. get_file_list is limited to
+// an hour, longer intervals are requested in hourly steps.
+func deliverCMRFiles(since, now time.Time) error {
+	for from := since; from.Before(now); from = from.Add(cdrOnDemandMaxInterval) {
+		to := from.Add(cdrOnDemandMaxInterval)
+		if to.After(now) {
+			to = now
+		}
+		body, err := cdrOnDemandRequest("get_file_list", getFileListXML(from, to))
+		if err != nil {
+			return err
+		}
+		envelope := new(CDROnDemandEnvelope)
+		xml.Unmarshal(body, envelope)
+		for _, item := range envelope.Body.GetFileListResponse.Return.Items {
+			file := strings.TrimSpace(item.Text)
+			if !strings.HasPrefix(file, "cmr_") {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(cmrDir, file)); err == nil {
+				continue
+			}
+			if _, err := cdrOnDemandRequest("get_file", getFileXML(file)); err != nil {
+				return err
+			}
+			debugPrintf(2, "CMR file %s requested\n", file)
+		}
+	}
+	return nil
+}
+
+// voice quality metrics of the records of a CMR file since a time. the first
+// line names the fields, the second their types.
+func readCMRFile(name string, since time.Time) ([]cmrRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CMR file %s: %s", name, err)
+	}
+	column := map[string]int{}
+	for i, field := range header {
+		column[strings.Trim(field, `" `)] = i
+	}
+	field := func(row []string, name string) string {
+		if i, ok := column[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	number := func(row []string, name string) float64 {
+		v, _ := strconv.ParseFloat(field(row, name), 64)
+		return v
+	}
+
+	records := []cmrRecord{}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CMR file %s: %s", name, err)
+		}
+		// the types line and the CDR records of mixed files
+		if field(row, "cdrRecordType") != "2" {
+			continue
+		}
+		if stamp, err := strconv.ParseInt(field(row, "dateTimeStamp"), 10, 64); err == nil && time.Unix(stamp, 0).Before(since) {
+			continue
+		}
+		record := cmrRecord{jitter: number(row, "jitter"), latency: number(row, "latency")}
+		if received, lost := number(row, "numberPacketsReceived"), number(row, "numberPacketsLost"); received+lost > 0 {
+			record.loss = lost / (received + lost) * 100
+		}
+		// varVQMetrics: "MLQK=4.0000;MLQKav=4.1000;MLQKmn=3.9000;..."
+		metrics := map[string]float64{}
+		for _, metric := range strings.Split(field(row, "varVQMetrics"), ";") {
+			if kv := strings.SplitN(metric, "=", 2); len(kv) == 2 {
+				metrics[strings.TrimSpace(kv[0])], _ = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			}
+		}
+		if record.mos = metrics["MLQKav"]; record.mos == 0 {
+			record.mos = metrics["MLQK"]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// records of the CMR files in -cmr-dir modified since a time
+func readCMRRecords(since time.Time) ([]cmrRecord, int, error) {
+	entries, err := ioutil.ReadDir(cmrDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	records := []cmrRecord{}
+	files := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "cmr_") || entry.ModTime().Before(since) {
+			continue
+		}
+		fileRecords, err := readCMRFile(filepath.Join(cmrDir, entry.Name()), since)
+		if err != nil {
+			return nil, 0, err
+		}
+		files++
+		records = append(records, fileRecords...)
+	}
+	return records, files, nil
+}
+
+// value at percentile p of sorted values, nearest rank
+func floatPercentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// average and percentile statistics of the CMR records, MOS only of the
+// records with a MOS as not every endpoint computes it
+func cmrStatistics(records []cmrRecord) map[string]float64 {
+	stats := map[string]float64{}
+	add := func(name string, values []float64, percentile float64) {
+		if len(values) == 0 {
+			return
+		}
+		sort.Float64s(values)
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		stats[name+"_avg"] = sum / float64(len(values))
+		stats[fmt.Sprintf("%s_p%.0f", name, percentile)] = floatPercentile(values, percentile)
+	}
+	mos, jitter, latency, loss := []float64{}, []float64{}, []float64{}, []float64{}
+	for _, r := range records {
+		if r.mos > 0 {
+			mos = append(mos, r.mos)
+		}
+		jitter = append(jitter, r.jitter)
+		latency = append(latency, r.latency)
+		loss = append(loss, r.loss)
+	}
+	// the low MOS and the high jitter, latency and loss percentiles are the bad calls
+	add("mos", mos, 5)
+	add("jitter", jitter, 95)
+	add("latency", latency, 95)
+	add("loss", loss, 95)
+	return stats
+}
+
+// check the voice quality of the calls of the last -cmr-interval from the CMR
+// records in -cmr-dir: average and percentile MOS, jitter, latency and packet
+// loss against -quality-thresholds. with -cmr-sftp the CMR files are first
+// requested from CDRonDemand of the -H publisher.
+func checkCallQuality() *checkResult {
+	if cmrDir == "" {
+		return &checkResult{returnVal: 3, text: "call quality check needs the CMR files directory, use -cmr-dir"}
+	}
+	thresholds, err := parseNodeThresholds(defaultQualityThresholds + ";" + qualityThresholds)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	now := time.Now()
+	since := now.Add(-cmrInterval)
+	if cmrSFTP != "" {
+		if err := deliverCMRFiles(since, now); err != nil {
+			return &checkResult{returnVal: 3, text: err.Error()}
+		}
+	}
+	records, files, err := readCMRRecords(since)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+	if len(records) == 0 {
+		return &checkResult{returnVal: 0, text: fmt.Sprintf("%s call quality: no CMR records in the last %s (%d files)", outputPrefix, shortDuration(cmrInterval), files), extraPerfdata: []string{"calls=0;;;0;"}}
+	}
+
+	stats := cmrStatistics(records)
+	names := []string{}
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{fmt.Sprintf("calls=%d;;;0;", len(records))}
+	for _, name := range names {
+		// loss in percent without uom, the output escapes the percent sign
+		uom := "ms"
+		if strings.HasPrefix(name, "mos") || strings.HasPrefix(name, "loss") {
+			uom = ""
+		}
+		value := strconv.FormatFloat(stats[name], 'f', 2, 64)
+		t := thresholds[name]
+		if t[0] != "" || t[1] != "" {
+			returnVal := getNagiosReturnVal(stats[name], t[0], t[1])
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s=%s%s %s", name, value, uom, returnValText(returnVal)))
+			}
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s%s;%s;%s;0;", name, value, uom, t[0], t[1]))
+	}
+
+	summary := fmt.Sprintf("MOS avg %.2f, jitter p95 %.0fms, loss avg %.2f percent", stats["mos_avg"], stats["jitter_p95"], stats["loss_avg"])
+	if _, ok := stats["mos_avg"]; !ok {
+		summary = fmt.Sprintf("no MOS, jitter p95 %.0fms, loss avg %.2f percent", stats["jitter_p95"], stats["loss_avg"])
+	}
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s call quality %d calls in the last %s: %s", outputPrefix, len(records), shortDuration(cmrInterval), summary),
+		extraPerfdata: perfdata,
+	}
+}
+
+// -dry-run plan of -mode call-quality
+func dryRunCallQuality(object string) (*dryRunPlan, error) {
+	plan := &dryRunPlan{}
+	if cmrSFTP != "" {
+		for _, apiHost := range apiHosts(ipAddr) {
+			plan.lines = append(plan.lines, fmt.Sprintf("endpoint: https://%s:8443%s", apiHost, cdrOnDemandPath))
+		}
+		plan.lines = append(plan.lines, "request: "+getFileListXML(time.Now().Add(-cmrInterval), time.Now()), "get_file: SFTP to "+cmrSFTP)
+	}
+	plan.lines = append(plan.lines, fmt.Sprintf("CMR files: %s last %s", cmrDir, shortDuration(cmrInterval)),
+		"thresholds: "+strings.Trim(defaultQualityThresholds+";"+qualityThresholds, ";"))
+	return plan, nil
+}
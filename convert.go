@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unit conversion of -convert: the value is multiplied by factor, uom is the
+// perfdata unit of the converted value
+type valueConversion struct {
+	factor float64
+	uom    string
+}
+
+var valueConversions = map[string]valueConversion{
+	"bytes2kb": {1.0 / 1024, "KB"},
+	"bytes2mb": {1.0 / (1024 * 1024), "MB"},
+	"bytes2gb": {1.0 / (1024 * 1024 * 1024), "GB"},
+	"kb2mb":    {1.0 / 1024, "MB"},
+	"kb2gb":    {1.0 / (1024 * 1024), "GB"},
+	"mb2gb":    {1.0 / 1024, "GB"},
+	"us2ms":    {1.0 / 1000, "ms"},
+	"us2s":     {1.0 / 1000000, "s"},
+	"ms2s":     {1.0 / 1000, "s"},
+}
+
+// conversion of -convert, an error for unknown conversions
+func valueConversionOf(name string) (valueConversion, error) {
+	conversion, ok := valueConversions[strings.ToLower(name)]
+	if !ok {
+		names := []string{}
+		for n := range valueConversions {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return conversion, fmt.Errorf("unknown -convert: %s, use %s", name, strings.Join(names, ", "))
+	}
+	return conversion, nil
+}
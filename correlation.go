@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// node and number of the CUCM request the log lines belong to, guarded by
+// the mutex as debugPrintf may be called from concurrent goroutines
+type correlationState struct {
+	sync.Mutex
+	node    string
+	request int
+	count   int
+}
+
+var correlation = &correlationState{}
+
+// random correlation ID of this invocation if -correlation-id is not given
+func newCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// log line prefix with the invocation, node and request correlation IDs
+func correlationPrefix() string {
+	correlation.Lock()
+	defer correlation.Unlock()
+	prefix := "[" + correlationID
+	if correlation.node != "" {
+		prefix += " node=" + correlation.node
+	}
+	if correlation.request > 0 {
+		prefix += fmt.Sprintf(" req=%d", correlation.request)
+	}
+	return prefix + "] "
+}
+
+// ID of the current CUCM request sent as X-Request-ID header
+func requestCorrelationID() string {
+	correlation.Lock()
+	defer correlation.Unlock()
+	return fmt.Sprintf("%s-%d", correlationID, correlation.request)
+}
+
+// correlate the following log lines with node, the returned func restores
+// the previous node
+func correlateNode(node string) func() {
+	correlation.Lock()
+	defer correlation.Unlock()
+	previous := correlation.node
+	correlation.node = node
+	return func() {
+		correlation.Lock()
+		defer correlation.Unlock()
+		correlation.node = previous
+	}
+}
+
+// correlate the following log lines with a new request number, the returned
+// func ends the request
+func correlateRequest() func() {
+	correlation.Lock()
+	defer correlation.Unlock()
+	correlation.count++
+	previous := correlation.request
+	correlation.request = correlation.count
+	return func() {
+		correlation.Lock()
+		defer correlation.Unlock()
+		correlation.request = previous
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default thresholds of -mode cpu, the average % CPU Time of the cores
+const (
+	cpuAvgWarning  = "80"
+	cpuAvgCritical = "90"
+)
+
+// check the % CPU Time of all cores of the Processor object. the thresholds
+// apply to the average of the cores, -w and -c override the defaults. a single
+// core at or above -cpu-pegged is at least WARNING. _Total is only used if
+// there are no per core instances.
+func checkCPU(nodes []string) *checkResult {
+	avgWarning, avgCritical := cpuAvgWarning, cpuAvgCritical
+	if thresholdGiven("w") {
+		avgWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		avgCritical = criticalThreshold
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	summary := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, textPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, textPrefix = node+"/", node+" "
+		}
+
+		counterEnvelope, _, err := collectCounterData(ipAddr, node, "Processor")
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			continue
+		}
+
+		cores := map[string]float64{}
+		total, hasTotal := 0.0, false
+		prefix := "\\\\" + node + "\\Processor("
+		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+			if !strings.HasPrefix(v.Name.Text, prefix) || !strings.HasSuffix(v.Name.Text, ")\\% CPU Time") {
+				continue
+			}
+			value, err := strconv.ParseFloat(counterValueText(v.Value.Text), 64)
+			if err != nil {
+				continue
+			}
+			instance := strings.TrimSuffix(strings.TrimPrefix(v.Name.Text, prefix), ")\\% CPU Time")
+			if instance == "_Total" {
+				total, hasTotal = value, true
+				continue
+			}
+			if !instanceAllowed(instance) {
+				continue
+			}
+			cores[instance] = value
+		}
+		if len(cores) == 0 && hasTotal {
+			cores["_Total"] = total
+		}
+		if len(cores) == 0 {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s no %% CPU Time counters", node))
+			continue
+		}
+
+		names := []string{}
+		for name := range cores {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, errA := strconv.Atoi(names[i])
+			b, errB := strconv.Atoi(names[j])
+			if errA == nil && errB == nil {
+				return a < b
+			}
+			return names[i] < names[j]
+		})
+
+		sum, max := 0.0, 0.0
+		pegged := []string{}
+		corePerfdata := []string{}
+		for _, name := range names {
+			value := cores[name]
+			sum += value
+			if value > max {
+				max = value
+			}
+			if value >= cpuPegged {
+				pegged = append(pegged, fmt.Sprintf("core %s at %.0f%%", name, value))
+			}
+			corePerfdata = append(corePerfdata, fmt.Sprintf("%score_%s=%s;%g;;0;100", labelPrefix, name, strconv.FormatFloat(value, 'f', -1, 64), cpuPegged))
+		}
+		avg := sum / float64(len(names))
+		avgText := strconv.FormatFloat(avg, 'f', 1, 64)
+
+		returnVal := getNagiosReturnVal(avg, avgWarning, avgCritical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%savg %s%% %s", textPrefix, avgText, returnValText(returnVal)))
+		}
+		if len(pegged) > 0 {
+			if returnVal == 0 {
+				returnVal = 1
+			}
+			problems = append(problems, fmt.Sprintf("%spegged %s", textPrefix, strings.Join(pegged, ", ")))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+
+		summary = append(summary, fmt.Sprintf("%savg=%s%% max=%s%% (%d cores)", textPrefix, avgText, strconv.FormatFloat(max, 'f', -1, 64), len(names)))
+		perfdata = append(perfdata,
+			fmt.Sprintf("%scpu_avg=%s;%s;%s;0;100", labelPrefix, avgText, avgWarning, avgCritical),
+			fmt.Sprintf("%scpu_max=%s;%g;;0;100", labelPrefix, strconv.FormatFloat(max, 'f', -1, 64), cpuPegged))
+		perfdata = append(perfdata, corePerfdata...)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - avg %s%%, max %s%%, %d cores", node, returnValText(returnVal), avgText, strconv.FormatFloat(max, 'f', -1, 64), len(names)))
+	}
+
+	text := fmt.Sprintf("%s CPU %s", outputPrefix, strings.Join(summary, ", "))
+	if len(problems) > 0 {
+		text += ": " + strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          text,
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode cpu
+func dryRunCPU(object string) (*dryRunPlan, error) {
+	avgWarning, avgCritical := cpuAvgWarning, cpuAvgCritical
+	if thresholdGiven("w") {
+		avgWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		avgCritical = criticalThreshold
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{"Processor", "Processor(*)", "% CPU Time", avgWarning, avgCritical}}}, nil
+}
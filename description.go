@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type (
+	PerfmonQueryCounterDescription struct {
+		XMLName struct{} `xml:"soap:perfmonQueryCounterDescription"`
+		Counter string   `xml:"soap:Counter"`
+	}
+
+	CounterDescriptionEnvelope struct {
+		XMLName xml.Name `xml:"Envelope"`
+		Body    struct {
+			PerfmonQueryCounterDescriptionResponse struct {
+				HelpText string `xml:"HelpText"`
+			} `xml:"perfmonQueryCounterDescriptionResponse"`
+			Fault struct {
+				Faultstring string `xml:"faultstring"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+)
+
+// help text of a full counter name via perfmonQueryCounterDescription, cached
+// like the counter catalog with -catalog-cache-age
+func counterDescription(ipAddr, nodeIpAddr, fullCounterName string) (string, error) {
+	cacheObject := fmt.Sprintf("counterDescription_%x", md5.Sum([]byte(fullCounterName)))
+	envelope := new(CounterDescriptionEnvelope)
+	if replayFile == "" && catalogCacheAge > 0 && loadStruct(nodeIpAddr, cacheObject, catalogCacheAge, envelope) {
+		debugPrintf(3, "counter description cache file used\n")
+		return envelope.Body.PerfmonQueryCounterDescriptionResponse.HelpText, nil
+	}
+
+	body, _, err := perfmonRequest(ipAddr, &PerfmonQueryCounterDescription{Counter: fullCounterName})
+	if err != nil {
+		return "", err
+	}
+	if err := xml.Unmarshal(body, envelope); err != nil {
+		return "", fmt.Errorf("CounterDescriptionEnvelope XML unmarshal error: %s", err)
+	}
+	if envelope.Body.Fault.Faultstring != "" {
+		return "", fmt.Errorf("perfmonQueryCounterDescription fault: %s", envelope.Body.Fault.Faultstring)
+	}
+	if replayFile == "" && catalogCacheAge > 0 {
+		saveStruct(nodeIpAddr, cacheObject, envelope)
+	}
+	return envelope.Body.PerfmonQueryCounterDescriptionResponse.HelpText, nil
+}
+
+// long output line with the description of a counter, empty if not available
+func counterDescriptionText(ipAddr, nodeIpAddr, fullCounterName string) string {
+	if replayFile != "" {
+		return ""
+	}
+	description, err := counterDescription(ipAddr, nodeIpAddr, fullCounterName)
+	if err != nil {
+		debugPrintf(2, "counter description error: %s\n", err)
+		return ""
+	}
+	description = strings.Join(strings.Fields(description), " ")
+	if description == "" {
+		return ""
+	}
+	return "description: " + description
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// device name to device pool map of all phones via AXL, cached like the counter catalog
+type DevicePools struct {
+	Pools map[string]string
+}
+
+func phoneDevicePools(ipAddr string) (map[string]string, error) {
+	cached := new(DevicePools)
+	if catalogCacheAge > 0 && loadStruct(ipAddr, "AXL devicepool", catalogCacheAge, cached) {
+		return cached.Pools, nil
+	}
+	rows, err := axlSQLQuery(ipAddr, "select d.name, dp.name as devicepool from device d inner join devicepool dp on d.fkdevicepool = dp.pkid where d.tkclass = 1")
+	if err != nil {
+		return nil, err
+	}
+	cached.Pools = map[string]string{}
+	for _, row := range rows {
+		cached.Pools[row["name"]] = row["devicepool"]
+	}
+	if catalogCacheAge > 0 {
+		saveStruct(ipAddr, "AXL devicepool", cached)
+	}
+	return cached.Pools, nil
+}
+
+// registration summary of the phones per device pool: the device pools come
+// from AXL, the registration status from RisPort. -w and -c are the number of
+// unregistered phones of a pool and only evaluated if given, a pool without
+// any registered phone is always CRITICAL.
+func checkDevicePools() *checkResult {
+	pools, err := phoneDevicePools(ipAddr)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("AXL device pool query failed: %s", err)}
+	}
+	devices, err := risDevices(ipAddr, "Phone")
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	registered := map[string]bool{}
+	for _, device := range devices {
+		if risRegistered(device) {
+			registered[device.Name] = true
+		}
+	}
+	total, unregistered := map[string]int{}, map[string]int{}
+	for name, pool := range pools {
+		if !instanceAllowed(pool) {
+			continue
+		}
+		total[pool]++
+		if !registered[name] {
+			unregistered[pool]++
+		}
+	}
+	names := []string{}
+	for pool := range total {
+		names = append(names, pool)
+	}
+	sort.Strings(names)
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	entries := []listEntry{}
+	unregisteredTotal := 0
+	warning, critical := givenThresholds()
+	for _, pool := range names {
+		returnVal := givenThresholdsReturnVal(float64(unregistered[pool]), warning, critical)
+		status := fmt.Sprintf("%d of %d unregistered", unregistered[pool], total[pool])
+		if unregistered[pool] == total[pool] {
+			returnVal = 2
+			status = fmt.Sprintf("all %d unregistered", total[pool])
+		}
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s %s", pool, status))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		unregisteredTotal += unregistered[pool]
+		entries = append(entries, listEntry{
+			name:     pool,
+			value:    float64(unregistered[pool]),
+			line:     fmt.Sprintf("%s: %s %s", pool, status, returnValText(returnVal)),
+			perfdata: fmt.Sprintf("%s_unregistered=%d;%s;%s;0;%d", strings.Replace(pool, " ", "_", -1), unregistered[pool], warning, critical, total[pool]),
+		})
+	}
+	longOutput, poolPerfdata := sortLimitEntries(entries)
+	perfdata = append(perfdata, poolPerfdata...)
+
+	summary := fmt.Sprintf("%d unregistered", unregisteredTotal)
+	if len(problems) > 0 {
+		summary += ": " + strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %d device pools, %d phones, %s", outputPrefix, len(names), len(pools), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode device-pools
+func dryRunDevicePools(object string) (*dryRunPlan, error) {
+	return dryRunRisPort("unregistered phones per device pool"), nil
+}
+
+// RisPort and AXL requests of -mode device-pools and inventory, -w and -c
+// are only evaluated if given
+func dryRunRisPort(evaluated string) *dryRunPlan {
+	warning, critical := givenThresholds()
+	plan := &dryRunPlan{}
+	for _, apiHost := range apiHosts(ipAddr) {
+		plan.lines = append(plan.lines, fmt.Sprintf("endpoint: https://%s:8443%s", apiHost, risPortPath), fmt.Sprintf("endpoint: https://%s:8443/axl/", apiHost))
+	}
+	plan.lines = append(plan.lines, "request: "+selectCmDeviceXML("Phone", ""),
+		"cache file: "+cacheFileName(ipAddr, "RisPort Phone"),
+		fmt.Sprintf("%s warning: %s critical: %s", evaluated, warning, critical))
+	return plan
+}
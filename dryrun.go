@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// perfmon counter queried by a check, shown by -dry-run
+type dryRunQuery struct {
+	object, objectInstance, counterName string
+	warning, critical                   string
+}
+
+// requests of a check described by -dry-run: the perfmon counters queried on
+// every node, or for checks without perfmon counters the lines of their own
+// requests
+type dryRunPlan struct {
+	queries   []dryRunQuery
+	lines     []string
+	nodeLines func(node string) []string // further requests per node
+	uncached  bool                       // the counters are always requested
+	summary   []string                   // evaluation after the node requests
+}
+
+// -dry-run plan of the counter check without -mode
+func dryRunCounter(object string) (*dryRunPlan, error) {
+	if counterName == "" {
+		return nil, fmt.Errorf("no counter name given, use -n")
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, objectInstance, counterName, warningThreshold, criticalThreshold}}}, nil
+}
+
+// describe the requests, counters, thresholds and cache files a check would use
+// without contacting the server
+func dryRunLines(nodes []string, clusters []cluster, object string) ([]string, error) {
+	dryRun := dryRunCounter
+	if checkMode != "" {
+		mode, ok := checkModes[checkMode]
+		if !ok {
+			return nil, fmt.Errorf("unknown mode: %s", checkMode)
+		}
+		dryRun = mode.dryRun
+	}
+	plan, err := dryRun(object)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.queries) == 0 {
+		return plan.lines, nil
+	}
+
+	hosts := []string{ipAddr}
+	if len(clusters) > 0 {
+		hosts = []string{}
+		for _, c := range clusters {
+			hosts = append(hosts, c.host)
+		}
+	}
+
+	lines := plan.lines
+	for _, host := range hosts {
+		for _, apiHost := range apiHosts(host) {
+			if transport == "rest" {
+				lines = append(lines, fmt.Sprintf("endpoint: https://%s:8443%s/collectCounterData", apiHost, strings.TrimRight(restPath, "/")))
+			} else {
+				lines = append(lines, fmt.Sprintf("endpoint: https://%s:8443/perfmonservice/services/PerfmonPort", apiHost))
+			}
+		}
+		if transport != "rest" {
+			lines = append(lines, "SOAPAction: "+perfmonSOAPAction())
+		}
+
+		hostNodes := nodes
+		if len(clusters) > 0 {
+			hostNodes = []string{apiHosts(host)[0]}
+		} else if allNodes {
+			lines = append(lines, "nodes: discovered via AXL at runtime, showing -N node")
+		}
+		requested := map[string]bool{}
+		for _, node := range hostNodes {
+			lines = append(lines, "node: "+node)
+			if plan.nodeLines != nil {
+				lines = append(lines, plan.nodeLines(node)...)
+			}
+			for _, q := range plan.queries {
+				if !requested[q.object] {
+					requested[q.object] = true
+					lines = append(lines, "request: "+perfmonRequestXML(&PerfmonCollectCounterData{Host: node, Object: q.object}))
+					if noCache {
+						lines = append(lines, "cache file: none, -no-cache")
+					} else if plan.uncached {
+						lines = append(lines, "cache file: none, always requested")
+					} else {
+						lines = append(lines, fmt.Sprintf("cache file: %s max age: %ds", cacheFileName(node, q.object), objectCacheAge(q.object)))
+					}
+				}
+				warning, critical := q.warning, q.critical
+				if checkMode == "" {
+					warning, critical = thresholdsForNode(node)
+				}
+				counters := []string{"none"}
+				if instances := listedInstances(q.objectInstance); q.counterName != "" && instances != nil {
+					counters = []string{}
+					for _, instance := range instances {
+						counters = append(counters, getFullCounterName(node, q.object+"("+instance+")", q.counterName))
+					}
+				} else if q.counterName != "" {
+					counters = []string{getFullCounterName(node, q.objectInstance, q.counterName)}
+				}
+				for _, counter := range counters {
+					lines = append(lines, fmt.Sprintf("counter: %s warning: %s critical: %s", counter, warning, critical))
+				}
+				if checkMode == "" && (scaleFactor != 1 || convertUnit != "") {
+					lines = append(lines, fmt.Sprintf("value: scaled by %g, converted %s (thresholds in the converted unit)", scaleFactor, convertUnit))
+				}
+				if checkMode == "" && len(expectedValues()) > 0 {
+					lines = append(lines, fmt.Sprintf("value: expected %s, the -w/-c ranges don't apply", strings.Trim(expectValue+","+expectOneOf, ",")))
+				}
+				if checkMode == "" && capacityCounter != "" {
+					lines = append(lines, "capacity counter: "+getFullCounterName(node, q.objectInstance, capacityCounter)+" (thresholds in percent)")
+				}
+			}
+			requested = map[string]bool{}
+		}
+	}
+
+	lines = append(lines, plan.summary...)
+
+	key := checkKey()
+	lines = append(lines, "state key: "+key, "state file: "+stateFileName(key))
+	return lines, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Elasticsearch/OpenSearch document of a counter value
+type esDocument struct {
+	Timestamp string  `json:"@timestamp"`
+	Cluster   string  `json:"cluster"`
+	Node      string  `json:"node"`
+	Object    string  `json:"object,omitempty"`
+	Instance  string  `json:"instance,omitempty"`
+	Counter   string  `json:"counter"`
+	Value     float64 `json:"value"`
+	Unit      string  `json:"unit,omitempty"`
+	Status    string  `json:"status"`
+}
+
+// index name of the -es-index pattern, {date} is replaced with the UTC date YYYY.MM.DD
+func esIndexName(t time.Time) string {
+	return strings.Replace(esIndex, "{date}", t.UTC().Format("2006.01.02"), -1)
+}
+
+// bulk index the metrics into the -es-index of the -es-url
+func indexElasticsearch(metrics []metric) error {
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, m := range metrics {
+		t := time.Unix(m.Time, 0)
+		enc.Encode(map[string]interface{}{"index": map[string]string{"_index": esIndexName(t)}})
+		enc.Encode(esDocument{
+			Timestamp: t.UTC().Format(time.RFC3339),
+			Cluster:   m.Host,
+			Node:      m.Node,
+			Object:    m.Object,
+			Instance:  m.Instance,
+			Counter:   m.Counter,
+			Value:     m.Value,
+			Unit:      m.Unit,
+			Status:    m.Status,
+		})
+	}
+
+	tlsConfig := fipsTLSConfig(&tls.Config{})
+	if esCA != "" {
+		pem, err := ioutil.ReadFile(esCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no CA certificate found in %s", esCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(esURL, "/")+"/_bulk", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case esAPIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+esAPIKey)
+	case esUser != "":
+		req.SetBasicAuth(esUser, esPassword)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bulk request %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	// the bulk request succeeds even if single documents were rejected
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("bulk response error: %s", err)
+	}
+	if result.Errors {
+		for _, item := range result.Items {
+			for _, action := range item {
+				if len(action.Error) > 0 {
+					return fmt.Errorf("document rejected: %s", action.Error)
+				}
+			}
+		}
+	}
+	debugPrintf(3, "%d documents indexed into %s\n", len(metrics), esIndex)
+	return nil
+}
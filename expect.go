@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -value-map presets of enumerated CUCM counters
+var valueMapPresets = map[string]string{
+	// Number of Replicates Created and State of Replication\Replicate_State
+	"replication": "0=replication not started,1=replicates created but count incorrect,2=replication good,3=replication suspect,4=replication setup failed",
+}
+
+// numeric values of a comma separated list like "1,2"
+func parseValueList(list string) ([]float64, error) {
+	values := []float64{}
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected value: %s", s)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// values of -expect and -expect-one-of, none if the thresholds apply
+func expectedValues() []float64 {
+	values, _ := parseValueList(expectValue + "," + expectOneOf)
+	return values
+}
+
+// meanings of the values of -value-map value=meaning,... or a preset name
+func valueMeanings() map[float64]string {
+	spec := valueMap
+	if preset, ok := valueMapPresets[spec]; ok {
+		spec = preset
+	}
+	meanings := map[float64]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		fields := strings.SplitN(entry, "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err == nil {
+			meanings[value] = strings.TrimSpace(fields[1])
+		}
+	}
+	return meanings
+}
+
+// validate -expect, -expect-one-of and -value-map
+func checkExpect() error {
+	if _, err := parseValueList(expectValue + "," + expectOneOf); err != nil {
+		return err
+	}
+	if valueMap != "" && len(valueMeanings()) == 0 {
+		return fmt.Errorf("invalid -value-map: %s, use value=meaning,... or one of the presets: replication", valueMap)
+	}
+	return nil
+}
+
+// return value of a counter value: with -expect or -expect-one-of CRITICAL if
+// the value is not expected, the ranges don't apply to enumerations. otherwise
+// the warning and critical ranges.
+func evaluateValue(value float64, warning, critical string) int {
+	expected := expectedValues()
+	if len(expected) == 0 {
+		return getNagiosReturnVal(value, warning, critical)
+	}
+	for _, e := range expected {
+		if value == e {
+			return 0
+		}
+	}
+	return 2
+}
+
+// text following a counter value: its -value-map meaning and the expected
+// values if not one of them, e.g. " (replication suspect), expected 2"
+func expectText(value float64, returnVal int) string {
+	text := ""
+	if meaning, ok := valueMeanings()[value]; ok {
+		text = " (" + meaning + ")"
+	}
+	if expected := expectedValues(); len(expected) > 0 && returnVal != 0 {
+		values := []string{}
+		for _, e := range expected {
+			values = append(values, strconv.FormatFloat(e, 'f', -1, 64))
+		}
+		if len(values) == 1 {
+			text += ", expected " + values[0]
+		} else {
+			text += ", expected one of " + strings.Join(values, ",")
+		}
+	}
+	return text
+}
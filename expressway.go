@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// element of the Expressway/VCS status XML
+type xmlNode struct {
+	XMLName xml.Name
+	Text    string    `xml:",chardata"`
+	Nodes   []xmlNode `xml:",any"`
+}
+
+// short names of the -mode expressway -n status values, paths below /Status
+var expresswayValues = map[string]string{
+	"traversal_calls":     "ResourceUsage/Calls/Traversal/Current",
+	"non_traversal_calls": "ResourceUsage/Calls/NonTraversal/Current",
+	"registrations":       "ResourceUsage/Registrations/Current",
+	"rich_media_sessions": "ResourceUsage/RichMediaSessions/Current",
+	"cpu":                 "SystemUnit/Hardware/CPU/Usage",
+	"memory":              "SystemUnit/Hardware/Memory/Usage",
+}
+
+// elements below n matching the slash separated path, names case-insensitive
+func (n *xmlNode) find(path string) []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		matches := []*xmlNode{}
+		for _, node := range nodes {
+			for i := range node.Nodes {
+				if strings.EqualFold(node.Nodes[i].XMLName.Local, name) {
+					matches = append(matches, &node.Nodes[i])
+				}
+			}
+		}
+		nodes = matches
+	}
+	return nodes
+}
+
+// text of the first element matching the path
+func (n *xmlNode) text(path string) string {
+	if nodes := n.find(path); len(nodes) > 0 {
+		return strings.TrimSpace(nodes[0].Text)
+	}
+	return ""
+}
+
+// fetch the /Status XML of the Expressway status API
+func expresswayStatus(hostList string) (*xmlNode, error) {
+	client := newHTTPClient()
+	client.Transport.(*http.Transport).TLSClientConfig = newExpresswayTLSConfig()
+	var lastErr error
+
+	for _, host := range apiHosts(hostList) {
+		url := "https://" + host + "/getxml?location=/Status"
+		debugPrintf(3, "URL: %s\n", url)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(username, password)
+		resp, err := client.Do(req)
+		if err != nil {
+			debugPrintf(2, "Expressway %s unreachable: %s\n", host, err)
+			lastErr = err
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		debugPrintf(3, "Expressway status: %s\n", body)
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Expressway HTTP status: %s", resp.Status)
+		}
+		status := new(xmlNode)
+		if err := xml.Unmarshal(body, status); err != nil {
+			return nil, fmt.Errorf("Expressway XML unmarshal error: %s", err)
+		}
+		return status, nil
+	}
+	return nil, fmt.Errorf("HTTPS request error: %s", lastErr)
+}
+
+// check the zones, call and license resource usage of a Cisco Expressway/VCS.
+// -n zones is CRITICAL if a zone is not active, other -n names are a short name
+// from expresswayValues or a path below /Status checked against the thresholds.
+func checkExpressway() *checkResult {
+	if counterName == "" {
+		return &checkResult{node: ipAddr, returnVal: 3, text: "no status value given, use -n zones or a -n status path"}
+	}
+	status, err := expresswayStatus(ipAddr)
+	if err != nil {
+		return &checkResult{node: ipAddr, returnVal: 3, text: err.Error()}
+	}
+
+	if strings.EqualFold(counterName, "zones") {
+		zones := status.find("Zones/Zone")
+		down := []string{}
+		longOutput := []string{}
+		for _, zone := range zones {
+			name, state := zone.text("Name"), zone.text("Status")
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s", name, state))
+			if !strings.EqualFold(state, "Active") {
+				down = append(down, name)
+			}
+		}
+		r := &checkResult{
+			node:          ipAddr,
+			text:          fmt.Sprintf("%s Expressway %d of %d zones active", outputPrefix, len(zones)-len(down), len(zones)),
+			label:         "zones_active",
+			value:         strconv.Itoa(len(zones) - len(down)),
+			extraPerfdata: []string{fmt.Sprintf("zones_total=%d;;;0;", len(zones))},
+			longOutput:    longOutput,
+		}
+		if len(down) > 0 {
+			r.returnVal = 2
+			r.text += ", not active: " + strings.Join(down, ", ")
+		}
+		return r
+	}
+
+	path, label := counterName, counterName
+	if p, ok := expresswayValues[strings.ToLower(counterName)]; ok {
+		path = p
+	} else {
+		label = strings.Replace(strings.Trim(path, "/"), "/", "_", -1)
+	}
+	text := status.text(path)
+	if text == "" {
+		return &checkResult{node: ipAddr, returnVal: 3, text: fmt.Sprintf("Expressway status value %s not found", path), notFound: true}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return &checkResult{node: ipAddr, returnVal: 3, text: fmt.Sprintf("Expressway status value %s is not numeric: %s", path, text)}
+	}
+	return &checkResult{
+		node:      ipAddr,
+		returnVal: getNagiosReturnVal(value, warningThreshold, criticalThreshold),
+		text:      fmt.Sprintf("%s Expressway %s=%s", outputPrefix, label, text),
+		label:     label,
+		value:     text,
+		warning:   warningThreshold,
+		critical:  criticalThreshold,
+	}
+}
+
+// -dry-run plan of -mode expressway
+func dryRunExpressway(object string) (*dryRunPlan, error) {
+	plan := &dryRunPlan{}
+	for _, apiHost := range apiHosts(ipAddr) {
+		plan.lines = append(plan.lines, fmt.Sprintf("endpoint: https://%s/getxml?location=/Status", apiHost))
+	}
+	path := counterName
+	if p, ok := expresswayValues[strings.ToLower(counterName)]; ok {
+		path = p
+	}
+	plan.lines = append(plan.lines, fmt.Sprintf("status value: %s warning: %s critical: %s", path, warningThreshold, criticalThreshold))
+	return plan, nil
+}
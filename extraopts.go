@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// plugins.ini locations searched by the monitoring plugins if -extra-opts
+// names no file, after the directories of NAGIOS_CONFIG_PATH
+var extraOptsFiles = []string{
+	"/etc/nagios/plugins.ini",
+	"/usr/local/nagios/etc/plugins.ini",
+	"/usr/local/etc/nagios/plugins.ini",
+	"/etc/opt/nagios/plugins.ini",
+	"/etc/nagios-plugins.ini",
+	"/usr/local/etc/nagios-plugins.ini",
+	"/etc/opt/nagios-plugins.ini",
+}
+
+// true if arg is -extra-opts or --extra-opts with or without =value
+func extraOptsArg(arg string) bool {
+	return argFlagName(arg) == "extra-opts"
+}
+
+// first existing default plugins.ini
+func defaultExtraOptsFile() (string, error) {
+	files := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("NAGIOS_CONFIG_PATH")) {
+		if dir != "" {
+			files = append(files, filepath.Join(dir, "plugins.ini"), filepath.Join(dir, "nagios-plugins.ini"))
+		}
+	}
+	for _, file := range append(files, extraOptsFiles...) {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("no plugins.ini found")
+}
+
+// options of the section of an ini file as -key=value arguments. lines are
+// key=value or key for flags without value, lines starting with ; or # are
+// comments. a # within a line is part of the value, e.g. of a password.
+func readExtraOpts(spec string) ([]string, error) {
+	section, filename := spec, ""
+	if i := strings.Index(spec, "@"); i >= 0 {
+		section, filename = spec[:i], spec[i+1:]
+	}
+	if section == "" {
+		section = filepath.Base(os.Args[0])
+	}
+	if filename == "" {
+		var err error
+		if filename, err = defaultExtraOptsFile(); err != nil {
+			return nil, fmt.Errorf("-extra-opts: %s", err)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("-extra-opts: %s", err)
+	}
+
+	args := []string{}
+	found, inSection := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, ";"), strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			found = found || inSection
+		case inSection:
+			kv := strings.SplitN(line, "=", 2)
+			arg := "-" + strings.TrimSpace(kv[0])
+			if len(kv) == 2 {
+				arg += "=" + strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			args = append(args, arg)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("-extra-opts: section [%s] not found in %s", section, filename)
+	}
+	return args, nil
+}
+
+// options of the ini sections of the -extra-opts arguments and the other
+// arguments. the ini options go first so the command line flags override them.
+func expandExtraOpts(args []string) ([]string, []string, error) {
+	extra, rest := []string{}, []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if !extraOptsArg(arg) {
+			rest = append(rest, arg)
+			continue
+		}
+		// -extra-opts=spec, -extra-opts spec or -extra-opts alone for the
+		// default section and file
+		spec := ""
+		if pos := strings.Index(arg, "="); pos >= 0 {
+			spec = arg[pos+1:]
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			spec = args[i+1]
+			i++
+		}
+		options, err := readExtraOpts(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		extra = append(extra, options...)
+	}
+	return extra, rest, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// FIPS 140 approved TLS 1.2 cipher suites, the TLS 1.3 suites are approved anyway
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// FIPS 140 approved key exchange curves
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// CA pool of -ca verifying the CUCM Tomcat certificate, nil skips the verification
+var cucmRootCAs *x509.CertPool
+
+// restricts cfg to TLS 1.2 or later with the FIPS approved cipher suites and
+// curves if -fips is set. the certificate is always verified in -fips mode.
+func fipsTLSConfig(cfg *tls.Config) *tls.Config {
+	if !fipsMode {
+		return cfg
+	}
+	cfg.MinVersion = tls.VersionTLS12
+	if cfg.MaxVersion != 0 && cfg.MaxVersion < tls.VersionTLS12 {
+		cfg.MaxVersion = 0
+	}
+	cfg.CipherSuites = fipsCipherSuites
+	cfg.CurvePreferences = fipsCurves
+	cfg.InsecureSkipVerify = false
+	return cfg
+}
+
+// loads the -ca file and refuses options that skip the certificate
+// verification in -fips mode
+func setupTLS() error {
+	if cucmCA != "" {
+		pem, err := ioutil.ReadFile(cucmCA)
+		if err != nil {
+			return err
+		}
+		cucmRootCAs = x509.NewCertPool()
+		if !cucmRootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no CA certificate found in %s", cucmCA)
+		}
+	}
+	if !fipsMode {
+		if fipsDefault {
+			return fmt.Errorf("this build enforces the FIPS mode, -fips=false is not supported")
+		}
+		return nil
+	}
+	switch {
+	case cucmCA == "" && replayFile == "" && !dryRun && serverURL == "" && serveAddr == "" && command != "daemon" && command != "cache":
+		return fmt.Errorf("-fips refuses to skip the verification of the CUCM Tomcat certificate, use -ca with the CA certificate file")
+	case serverURL != "" && serverCA == "":
+		return fmt.Errorf("-fips refuses to skip the verification of the -server certificate, use -server-ca")
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build !fips
+
+package main
+
+// the FIPS mode is off by default
+const fipsDefault = false
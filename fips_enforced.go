@@ -0,0 +1,6 @@
+//go:build fips
+
+package main
+
+// the FIPS mode is on and can't be switched off
+const fipsDefault = true
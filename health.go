@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// key counter of the cluster health summary
+type healthIndicator struct {
+	name           string // short name used in output and perfdata
+	object         string
+	objectInstance string
+	counterName    string
+	warning        string // empty thresholds: informational only
+	critical       string
+}
+
+var healthIndicators = []healthIndicator{
+	{"cpu", "Processor", "Processor(_Total)", "% CPU Time", "80", "90"},
+	{"memory", "Memory", "Memory", "% VM Used", "80", "90"},
+	{"disk_active", "Partition", "Partition(Active)", "% Used", "80", "90"},
+	{"disk_common", "Partition", "Partition(Common)", "% Used", "80", "90"},
+	{"replication", "Number of Replicates Created and State of Replication", "Number of Replicates Created and State of Replication(ReplicateCount)", "Replicate_State", "2:2", "2:2"},
+	{"calls_active", "Cisco CallManager", "Cisco CallManager", "CallsActive", "", ""},
+	{"heartbeat", "Cisco CallManager", "Cisco CallManager", "CallManagerHeartBeat", "", ""},
+	{"registered_phones", "Cisco CallManager", "Cisco CallManager", "RegisteredHardwarePhones", "", ""},
+}
+
+// collect the health indicators of every node and summarize them to one check
+// result with the indicators in long output
+func checkHealth(nodes []string) *checkResult {
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+	children := []childResult{}
+
+	for _, node := range nodes {
+		envelopes := map[string]*CounterEnvelope{}
+
+		for _, indicator := range healthIndicators {
+			counterEnvelope, ok := envelopes[indicator.object]
+			if !ok {
+				var err error
+				counterEnvelope, _, err = collectCounterData(ipAddr, node, indicator.object)
+				if err != nil {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					problems = append(problems, fmt.Sprintf("%s %s", node, err))
+					longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+					children = append(children, childResult{name: node, returnVal: 3, text: err.Error()})
+					break
+				}
+				envelopes[indicator.object] = counterEnvelope
+			}
+
+			fullCounterName := getFullCounterName(node, indicator.objectInstance, indicator.counterName)
+			valueText, found := findCounterValue(counterEnvelope, fullCounterName)
+			if !found {
+				longOutput = append(longOutput, fmt.Sprintf("%s: %s %s\\%s n/a", node, indicator.name, indicator.objectInstance, indicator.counterName))
+				continue
+			}
+
+			returnVal := 0
+			if indicator.warning != "" {
+				value, err := strconv.ParseFloat(valueText, 64)
+				if err != nil {
+					returnVal = 3
+				} else {
+					returnVal = getNagiosReturnVal(value, indicator.warning, indicator.critical)
+				}
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s %s=%s %s", node, indicator.name, valueText, returnValText(returnVal)))
+			}
+			perfdata = append(perfdata, fmt.Sprintf("%s/%s=%s;%s;%s;;", node, indicator.name, valueText, indicator.warning, indicator.critical))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s %s\\%s=%s %s", node, indicator.name, indicator.objectInstance, indicator.counterName, valueText, returnValText(returnVal)))
+			children = append(children, childResult{name: node + "/" + indicator.name, returnVal: returnVal, text: fmt.Sprintf("%s\\%s=%s", indicator.objectInstance, indicator.counterName, valueText)})
+		}
+	}
+
+	if warnCertDays > 0 {
+		if certText := certExpiryText(ipAddr); certText != "" {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 1)
+			problems = append(problems, strings.TrimPrefix(certText, " - "))
+		}
+	}
+
+	summary := "all indicators OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s health %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+		children:      children,
+	}
+}
+
+// -dry-run plan of -mode health
+func dryRunHealth(object string) (*dryRunPlan, error) {
+	plan := &dryRunPlan{}
+	for _, indicator := range healthIndicators {
+		plan.queries = append(plan.queries, dryRunQuery{indicator.object, indicator.objectInstance, indicator.counterName, indicator.warning, indicator.critical})
+	}
+	return plan, nil
+}
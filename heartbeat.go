@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// check that the heartbeat counter of every node increments between runs.
+// the last value and the time it changed are kept in the state file, a value
+// not changed for -heartbeat-stall is CRITICAL. a lower value is
+// a restarted service. default counter is Cisco CallManager\CallManagerHeartBeat.
+func checkHeartbeat(nodes []string) *checkResult {
+	hbObjectInstance, hbCounter := "Cisco CallManager", "CallManagerHeartBeat"
+	if counterName != "" {
+		hbObjectInstance, hbCounter = objectInstance, counterName
+	}
+	hbObject := perfmonObject(hbObjectInstance)
+
+	state := currentCheckState()
+	if state == nil {
+		return &checkResult{returnVal: 3, text: "heartbeat check needs the state file, see -state-dir"}
+	}
+
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		// always fetched, a cached response would look like a stalled heartbeat
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, hbObject)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+		valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, hbObjectInstance, hbCounter))
+		value, err := strconv.ParseFloat(valueText, 64)
+		if !found || err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s n/a", node, hbCounter))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s\\%s n/a", node, returnValText(3), hbObjectInstance, hbCounter))
+			continue
+		}
+
+		returnVal := 0
+		status, stalled := heartbeatStatus(state, "heartbeat "+node, value, now)
+		if stalled >= heartbeatStall {
+			returnVal = 2
+			problems = append(problems, fmt.Sprintf("%s heartbeat stalled for %s", node, shortDuration(stalled)))
+		}
+
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata, fmt.Sprintf("%s/heartbeat=%sc;;;;", node, valueText))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s=%s %s", node, returnValText(returnVal), hbCounter, valueText, status))
+	}
+
+	summary := "heartbeat incrementing"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d nodes: %s", outputPrefix, hbCounter, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// compare a heartbeat value with the last value and unix time of its last
+// change kept in the state data under key. returns the status text and how
+// long the value is unchanged, -1 if it changed or on the first run.
+func heartbeatStatus(state *CheckState, key string, value float64, now time.Time) (string, time.Duration) {
+	status := "first run, no previous heartbeat"
+	stalled := time.Duration(-1)
+	changed := now.Unix()
+	if fields := strings.Fields(state.Data[key]); len(fields) == 2 {
+		last, _ := strconv.ParseFloat(fields[0], 64)
+		lastChanged, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch {
+		case value > last:
+			status = fmt.Sprintf("incremented by %s", strconv.FormatFloat(value-last, 'f', -1, 64))
+		case value < last:
+			status = "restarted, heartbeat reset"
+		default:
+			changed = lastChanged
+			stalled = now.Sub(time.Unix(lastChanged, 0)).Truncate(time.Second)
+			status = fmt.Sprintf("unchanged for %s", shortDuration(stalled))
+		}
+	}
+	state.Data[key] = fmt.Sprintf("%s %d", strconv.FormatFloat(value, 'f', -1, 64), changed)
+	return status, stalled
+}
+
+// -dry-run plan of -mode heartbeat, -n selects another heartbeat counter
+func dryRunHeartbeat(object string) (*dryRunPlan, error) {
+	if counterName != "" {
+		return &dryRunPlan{queries: []dryRunQuery{{object, objectInstance, counterName, "", "stalled"}}}, nil
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{"Cisco CallManager", "Cisco CallManager", "CallManagerHeartBeat", "", "stalled"}}}, nil
+}
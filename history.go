@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sample of the history file
+type historySample struct {
+	Time  int64
+	Value float64
+}
+
+// history file of a check key next to its state file
+func historyFileName(key string) string {
+	return strings.TrimSuffix(stateFileName(key), ".json") + "_history.tsv"
+}
+
+// read the samples of a history file, lines: unix time and value tab separated
+func readHistory(filename string) ([]historySample, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := []historySample{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		t, err1 := strconv.ParseInt(fields[0], 10, 64)
+		v, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 == nil && err2 == nil {
+			samples = append(samples, historySample{t, v})
+		}
+	}
+	return samples, scanner.Err()
+}
+
+// append a sample to the history file. samples older than -history-retention
+// are removed once they are a day over the retention, so the file is only
+// rewritten about once a day.
+func appendHistory(filename string, samples []historySample, sample historySample) error {
+	cutoff := sample.Time - int64(historyRetention.Seconds())
+	if len(samples) > 0 && samples[0].Time < cutoff-86400 {
+		kept := []string{}
+		for _, s := range samples {
+			if s.Time >= cutoff {
+				kept = append(kept, fmt.Sprintf("%d\t%s\n", s.Time, strconv.FormatFloat(s.Value, 'f', -1, 64)))
+			}
+		}
+		tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.WriteString(strings.Join(kept, ""))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filename)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d\t%s\n", sample.Time, strconv.FormatFloat(sample.Value, 'f', -1, 64))
+	return err
+}
+
+// growth in percent of the value compared to the newest sample at least
+// -trend-window old. false if the history doesn't cover the window yet.
+func trendGrowth(samples []historySample, sample historySample) (float64, bool) {
+	start := sample.Time - int64(trendWindow.Seconds())
+	var base *historySample
+	for i := range samples {
+		if samples[i].Time > start {
+			break
+		}
+		base = &samples[i]
+	}
+	if base == nil || base.Value == 0 {
+		return 0, false
+	}
+	return (sample.Value - base.Value) / math.Abs(base.Value) * 100, true
+}
+
+// state of a growth against the trend thresholds, an empty threshold is not evaluated
+func trendReturnVal(growth float64, warning, critical string) int {
+	returnVal := 0
+	if warning != "" && generateAlert(growth, warning) {
+		returnVal = 1
+	}
+	if critical != "" && generateAlert(growth, critical) {
+		returnVal = 2
+	}
+	return returnVal
+}
+
+// duration without zero minutes and seconds, 24h instead of 24h0m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// record the value of a result in the history file and apply the trend thresholds
+func applyHistory(r *checkResult, state *CheckState) {
+	value, err := strconv.ParseFloat(r.value, 64)
+	if err != nil {
+		return
+	}
+	filename := historyFileName(state.Key)
+	samples, err := readHistory(filename)
+	if err != nil {
+		debugPrintf(1, "history file %s error: %s\n", filename, err)
+		return
+	}
+	sample := historySample{time.Now().Unix(), value}
+
+	if trendWarning != "" || trendCritical != "" {
+		growth, ok := trendGrowth(samples, sample)
+		if !ok {
+			r.text += fmt.Sprintf(" (trend over %s n/a, history too short)", shortDuration(trendWindow))
+		} else {
+			r.returnVal = worseReturnVal(r.returnVal, trendReturnVal(growth, trendWarning, trendCritical))
+			r.text += fmt.Sprintf(" (%+.1f%% over %s)", growth, shortDuration(trendWindow))
+			r.extraPerfdata = append(r.extraPerfdata, fmt.Sprintf("trend_pct=%.1f;%s;%s;;", growth, trendWarning, trendCritical))
+		}
+	}
+
+	if err := appendHistory(filename, samples, sample); err != nil {
+		debugPrintf(1, "history file %s error: %s\n", filename, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrendGrowth(t *testing.T) {
+	trendWindow = 24 * time.Hour
+	now := int64(1000000)
+	samples := []historySample{
+		{now - 48*3600, 50},
+		{now - 25*3600, 100},
+		{now - 12*3600, 110},
+	}
+
+	growth, ok := trendGrowth(samples, historySample{now, 125})
+	if !ok || growth != 25 {
+		t.Errorf("growth = %v, %v, want 25, true", growth, ok)
+	}
+	growth, ok = trendGrowth(samples, historySample{now, 80})
+	if !ok || growth != -20 {
+		t.Errorf("growth = %v, %v, want -20, true", growth, ok)
+	}
+	// history shorter than the window
+	if _, ok := trendGrowth(samples[2:], historySample{now, 125}); ok {
+		t.Error("growth of a history shorter than -trend-window")
+	}
+	// no growth in percent of zero
+	if _, ok := trendGrowth([]historySample{{now - 25*3600, 0}}, historySample{now, 10}); ok {
+		t.Error("growth of a zero base value")
+	}
+}
+
+func TestTrendReturnVal(t *testing.T) {
+	for _, test := range []struct {
+		growth            float64
+		warning, critical string
+		want              int
+	}{
+		{10, "~:20", "~:50", 0},
+		{25, "~:20", "~:50", 1},
+		{60, "~:20", "~:50", 2},
+		{60, "~:20", "", 1},
+		{60, "", "", 0},
+		{-30, "-20:", "-50:", 1},
+	} {
+		if got := trendReturnVal(test.growth, test.warning, test.critical); got != test.want {
+			t.Errorf("trendReturnVal(%v, %q, %q) = %d, want %d", test.growth, test.warning, test.critical, got, test.want)
+		}
+	}
+}
+
+func TestAppendHistoryRetention(t *testing.T) {
+	historyRetention = 2 * 24 * time.Hour
+	filename := filepath.Join(t.TempDir(), "history.tsv")
+	now := int64(10000000)
+
+	for _, s := range []historySample{{now - 4*86400, 1}, {now - 86400, 2.5}} {
+		samples, err := readHistory(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := appendHistory(filename, samples, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples, _ := readHistory(filename)
+	if len(samples) != 2 || samples[1].Value != 2.5 {
+		t.Fatalf("samples = %v, want both samples", samples)
+	}
+
+	// the oldest sample is more than a day over the retention
+	if err := appendHistory(filename, samples, historySample{now, 3}); err != nil {
+		t.Fatal(err)
+	}
+	samples, _ = readHistory(filename)
+	if len(samples) != 2 || samples[0].Time != now-86400 || samples[1].Time != now {
+		t.Errorf("samples = %v, want the last two", samples)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thresholds of a hunt pilot, the first matching -pilot-thresholds pattern
+// overrides -w and -c
+func thresholdsForPilot(pilot string, pilotThresholds map[string][2]string) (string, string) {
+	patterns := []string{}
+	for pattern := range pilotThresholds {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if re, err := globRegexp(pattern); err == nil && re.MatchString(pilot) {
+			return pilotThresholds[pattern][0], pilotThresholds[pattern][1]
+		}
+	}
+	return warningThreshold, criticalThreshold
+}
+
+// check the call queues of all hunt pilot instances: -w and -c are the queued
+// calls, -hunt-wait the longest waiting time in seconds and -hunt-abandoned
+// the abandoned calls per minute since the previous run
+func checkHuntPilots(nodes []string) *checkResult {
+	object := "Cisco Hunt Pilots"
+	if flagGiven("o") {
+		object = perfmonObject(objectInstance)
+	}
+	pilotThresholds, err := parseNodeThresholds(pilotThresholdList)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	state := currentCheckState()
+	now := time.Now()
+	combinedReturnVal := 0
+	checked := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			continue
+		}
+
+		values := map[string]map[string]float64{}
+		for _, counter := range []string{"CallsInQueue", "LongestWaitingTime", "CallsAbandoned"} {
+			for _, v := range counterInstances(counterEnvelope, node, object, counter) {
+				if values[v.instance] == nil {
+					values[v.instance] = map[string]float64{}
+				}
+				values[v.instance][counter] = v.value
+			}
+		}
+		pilots := []string{}
+		for pilot := range values {
+			pilots = append(pilots, pilot)
+		}
+		sort.Strings(pilots)
+
+		for _, pilot := range pilots {
+			v := values[pilot]
+			checked++
+			label := labelPrefix + pilot
+			warning, critical := thresholdsForPilot(pilot, pilotThresholds)
+			details := []string{}
+			returnVal := 0
+
+			if queued, ok := v["CallsInQueue"]; ok {
+				returnVal = getNagiosReturnVal(queued, warning, critical)
+				details = append(details, fmt.Sprintf("%.0f queued", queued))
+				perfdata = append(perfdata, fmt.Sprintf("%s_queued=%.0f;%s;%s;0;", label, queued, warning, critical))
+			}
+			if wait, ok := v["LongestWaitingTime"]; ok {
+				details = append(details, fmt.Sprintf("longest wait %s", shortDuration(time.Duration(wait)*time.Second)))
+				if huntWaitThreshold != "" && generateAlert(wait, huntWaitThreshold) {
+					returnVal = worseReturnVal(returnVal, 1)
+				}
+				perfdata = append(perfdata, fmt.Sprintf("%s_longest_wait=%.0fs;%s;;0;", label, wait, huntWaitThreshold))
+			}
+			if abandoned, ok := v["CallsAbandoned"]; ok && state != nil {
+				if rate, ok := counterRate(state, "hunt "+node+" "+pilot, abandoned, now); ok {
+					details = append(details, fmt.Sprintf("%.2f abandoned/min", rate))
+					if huntAbandonedThreshold != "" && generateAlert(rate, huntAbandonedThreshold) {
+						returnVal = worseReturnVal(returnVal, 1)
+					}
+					perfdata = append(perfdata, fmt.Sprintf("%s_abandoned_per_min=%.2f;%s;;0;", label, rate, huntAbandonedThreshold))
+				}
+				perfdata = append(perfdata, fmt.Sprintf("%s_abandoned=%sc;;;0;", label, strconv.FormatFloat(abandoned, 'f', -1, 64)))
+			}
+
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s %s", label, returnValText(returnVal)))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s %s", label, strings.Join(details, ", "), returnValText(returnVal)))
+		}
+	}
+
+	summary := "queues OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d pilots: %s", outputPrefix, object, checked, summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode hunt
+func dryRunHuntPilots(object string) (*dryRunPlan, error) {
+	instance := objectInstance
+	if !flagGiven("o") {
+		object, instance = "Cisco Hunt Pilots", "Cisco Hunt Pilots(*)"
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, instance, "CallsInQueue", warningThreshold, criticalThreshold},
+		{object, instance, "LongestWaitingTime", huntWaitThreshold + " seconds", ""},
+		{object, instance, "CallsAbandoned", huntAbandonedThreshold + " per minute", ""}}}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP client of the Icinga2 API with the -icinga2-ca and client certificate options
+func newIcinga2Client() (*http.Client, error) {
+	tlsConfig := fipsTLSConfig(&tls.Config{})
+	if icinga2CA != "" {
+		pem, err := ioutil.ReadFile(icinga2CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", icinga2CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if icinga2Cert != "" {
+		cert, err := tls.LoadX509KeyPair(icinga2Cert, icinga2Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+// submit a passive service check result with the Icinga2 API process-check-result action
+func postIcinga2Result(node string, r *checkResult) error {
+	if checkResultService == "" {
+		return fmt.Errorf("-checkresult-service is required with -icinga2-api")
+	}
+	host, service := checkResultTarget(node)
+
+	lines := []string{escapeOutput(fmt.Sprintf("%s - %s", returnValText(r.returnVal), r.text))}
+	for _, line := range r.longOutput {
+		lines = append(lines, escapeOutput(line))
+	}
+	perfdata := []string{}
+	for _, p := range resultPerfdata(r) {
+		perfdata = append(perfdata, escapeOutput(p))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"type":             "Service",
+		"filter":           "host.name==h && service.name==s",
+		"filter_vars":      map[string]string{"h": host, "s": service},
+		"exit_status":      r.returnVal,
+		"plugin_output":    strings.Join(lines, "\n"),
+		"performance_data": perfdata,
+		"check_source":     icinga2CheckSource,
+	})
+	if err != nil {
+		return err
+	}
+
+	client, err := newIcinga2Client()
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(icinga2API, "/") + "/v1/actions/process-check-result"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if icinga2User != "" {
+		req.SetBasicAuth(icinga2User, icinga2Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	debugPrintf(3, "Icinga2 API response: %s %s\n", resp.Status, respBody)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Icinga2 API %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	// the action succeeds with an empty result list if no service matched
+	var result struct {
+		Results []struct {
+			Code   float64 `json:"code"`
+			Status string  `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &result); err == nil && len(result.Results) == 0 {
+		return fmt.Errorf("Icinga2 API: no service %s!%s", host, service)
+	}
+	debugPrintf(3, "check result submitted to Icinga2: %s!%s\n", host, service)
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default counters and thresholds of -mode ils. the names of the ILS
+// counters differ between the releases, -ils-counters overrides them.
+const (
+	defaultILSCounters   = "sync_status=Cisco ILS\\SyncStatus,learned_objects=Cisco ILS\\LearnedObjects,failed_syncs=Cisco ILS\\FailedSyncs"
+	defaultILSThresholds = "learned_objects=1:,1:;failed_syncs=0,5"
+)
+
+// Intercluster Lookup Service counter of -mode ils, failed_syncs is a rate
+// evaluated as increase per minute since the previous run
+type ilsCounter struct {
+	name              string
+	object            string
+	counterName       string
+	warning, critical string
+}
+
+// parse -ils-counters name=object\counter,... and the default and
+// -ils-thresholds name=warning,critical;... ranges
+func parseILSCounters(counters, thresholds string) ([]ilsCounter, error) {
+	ils := []ilsCounter{}
+	for _, entry := range strings.Split(counters, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pos := strings.Index(entry, "=")
+		slash := strings.LastIndex(entry, "\\")
+		if pos == -1 || slash < pos {
+			return nil, fmt.Errorf("invalid ILS counter: %s, use name=object\\counter", entry)
+		}
+		ils = append(ils, ilsCounter{name: entry[:pos], object: entry[pos+1 : slash], counterName: entry[slash+1:]})
+	}
+
+	ranges, err := parseNodeThresholds(defaultILSThresholds + ";" + thresholds)
+	if err != nil {
+		return nil, err
+	}
+	for name, r := range ranges {
+		found := false
+		for i := range ils {
+			if ils[i].name == name {
+				ils[i].warning, ils[i].critical = r[0], r[1]
+				found = true
+			}
+		}
+		if !found && strings.Contains(thresholds, name+"=") {
+			return nil, fmt.Errorf("ILS thresholds for unknown counter: %s", name)
+		}
+	}
+	return ils, nil
+}
+
+// check the Intercluster Lookup Service of every node: the sync status, the
+// objects learned from the remote clusters and the failed syncs per minute,
+// so dial plan replication problems between clusters surface as alerts.
+func checkILS(nodes []string) *checkResult {
+	counters, err := parseILSCounters(ilsCounterList, ilsThresholdList)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	state := currentCheckState()
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		envelopes := map[string]*CounterEnvelope{}
+
+		for _, c := range counters {
+			rate := c.name == "failed_syncs"
+			counterEnvelope, ok := envelopes[c.object]
+			if !ok {
+				// rates need the current value
+				if rate {
+					counterEnvelope, _, err = fetchCounterData(ipAddr, node, c.object)
+				} else {
+					counterEnvelope, _, err = collectCounterData(ipAddr, node, c.object)
+				}
+				if err != nil {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					problems = append(problems, fmt.Sprintf("%s %s", node, err))
+					longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+					break
+				}
+				if len(counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo) == 0 {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					problems = append(problems, emptyCounterDataText([]string{node}, c.object))
+					break
+				}
+				envelopes[c.object] = counterEnvelope
+			}
+
+			label := labelPrefix + c.name
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, c.object, c.counterName))
+			value, err := strconv.ParseFloat(valueText, 64)
+			if !found || err != nil {
+				longOutput = append(longOutput, fmt.Sprintf("%s %s\\%s n/a", label, c.object, c.counterName))
+				continue
+			}
+
+			if rate {
+				perfdata = append(perfdata, fmt.Sprintf("%s=%sc;;;0;", label, valueText))
+				if state == nil {
+					longOutput = append(longOutput, fmt.Sprintf("%s %s total", label, valueText))
+					continue
+				}
+				rate, ok := counterRate(state, "ils "+node+" "+c.name, value, now)
+				if !ok {
+					longOutput = append(longOutput, fmt.Sprintf("%s %s total, rate n/a, first run", label, valueText))
+					continue
+				}
+				value, valueText = rate, strconv.FormatFloat(rate, 'f', 2, 64)
+				label += "_per_min"
+			}
+
+			returnVal := 0
+			if c.warning != "" || c.critical != "" {
+				returnVal = getNagiosReturnVal(value, c.warning, c.critical)
+			}
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s=%s %s", label, valueText, returnValText(returnVal)))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;%s;0;", label, valueText, c.warning, c.critical))
+			longOutput = append(longOutput, fmt.Sprintf("%s %s %s", label, valueText, returnValText(returnVal)))
+		}
+	}
+
+	summary := "ILS OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s ILS %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode ils
+func dryRunILS(object string) (*dryRunPlan, error) {
+	counters, err := parseILSCounters(ilsCounterList, ilsThresholdList)
+	if err != nil {
+		return nil, err
+	}
+	plan := &dryRunPlan{}
+	for _, c := range counters {
+		q := dryRunQuery{c.object, c.object, c.counterName, c.warning, c.critical}
+		if c.name == "failed_syncs" {
+			q.warning, q.critical = q.warning+" per minute", q.critical+" per minute"
+		}
+		plan.queries = append(plan.queries, q)
+	}
+	return plan, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// value of a counter of one instance of a multi-instance object
+type instanceValue struct {
+	instance string
+	text     string
+	value    float64
+}
+
+// values of the counter of all instances of the object except _Total
+func counterInstances(counterEnvelope *CounterEnvelope, nodeIpAddr, object, counterName string) []instanceValue {
+	values := []instanceValue{}
+	prefix := "\\\\" + nodeIpAddr + "\\" + object + "("
+	suffix := ")\\" + counterName
+	for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+		if !strings.HasPrefix(v.Name.Text, prefix) || !strings.HasSuffix(v.Name.Text, suffix) {
+			continue
+		}
+		instance := strings.TrimSuffix(strings.TrimPrefix(v.Name.Text, prefix), suffix)
+		text := counterValueText(v.Value.Text)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || instance == "_Total" || !instanceAllowed(instance) {
+			continue
+		}
+		values = append(values, instanceValue{instance: instance, text: text, value: value})
+	}
+	return values
+}
+
+// long output lines of the -top N instances with the highest counter values,
+// with -sort name ordered by instance name
+func topInstancesText(counterEnvelope *CounterEnvelope, nodeIpAddr, object, counterName string, n int) []string {
+	values := counterInstances(counterEnvelope, nodeIpAddr, object, counterName)
+	if len(values) == 0 {
+		return nil
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].value > values[j].value })
+	if len(values) > n {
+		values = values[:n]
+	}
+	if instanceSort == "name" {
+		sort.SliceStable(values, func(i, j int) bool { return values[i].instance < values[j].instance })
+	}
+	lines := []string{fmt.Sprintf("top %d %s instances by %s:", len(values), object, counterName)}
+	for _, v := range values {
+		lines = append(lines, fmt.Sprintf("%s(%s)=%s", object, v.instance, v.text))
+	}
+	return lines
+}
+
+// entry of a multi-instance listing, line and perfdata are optional
+type listEntry struct {
+	name     string
+	value    float64
+	line     string
+	perfdata string
+}
+
+// order the entries by -sort (value descending or name, default response
+// order) and bound the long output lines and the perfdata of entries without
+// line to -limit entries each. evaluated entries always keep their perfdata.
+func sortLimitEntries(entries []listEntry) ([]string, []string) {
+	switch instanceSort {
+	case "value":
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].value > entries[j].value })
+	case "name":
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	lines, perfdata := []string{}, []string{}
+	omitted, extraPerfdata := 0, 0
+	for _, e := range entries {
+		if e.line != "" {
+			if instanceLimit > 0 && len(lines) >= instanceLimit {
+				omitted++
+			} else {
+				lines = append(lines, e.line)
+			}
+			if e.perfdata != "" {
+				perfdata = append(perfdata, e.perfdata)
+			}
+		} else if e.perfdata != "" && (instanceLimit == 0 || extraPerfdata < instanceLimit) {
+			perfdata = append(perfdata, e.perfdata)
+			extraPerfdata++
+		}
+	}
+	if omitted > 0 {
+		lines = append(lines, fmt.Sprintf("... %d more, see -limit", omitted))
+	}
+	return lines, perfdata
+}
+
+// compiled -include-instance and -exclude-instance patterns
+var includeInstanceRes, excludeInstanceRes []*regexp.Regexp
+
+// compile a comma separated glob list
+func compileGlobList(list string) []*regexp.Regexp {
+	res := []*regexp.Regexp{}
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		re, err := globRegexp(pattern)
+		if err != nil {
+			debugPrintf(1, "invalid instance pattern %s: %s\n", pattern, err)
+			continue
+		}
+		res = append(res, re)
+	}
+	return res
+}
+
+// instance name of an object(instance)\counter name, empty for single instance objects
+func instanceOf(instanceCounter string) string {
+	start := strings.Index(instanceCounter, "(")
+	end := strings.LastIndex(instanceCounter, ")\\")
+	if start == -1 || end < start {
+		return ""
+	}
+	return instanceCounter[start+1 : end]
+}
+
+// true unless the instance is filtered by -include-instance or -exclude-instance.
+// single instance objects are never filtered.
+func instanceAllowed(instance string) bool {
+	if instance == "" {
+		return true
+	}
+	if includeInstanceRes == nil {
+		includeInstanceRes, excludeInstanceRes = compileGlobList(includeInstances), compileGlobList(excludeInstances)
+	}
+	for _, re := range excludeInstanceRes {
+		if re.MatchString(instance) {
+			return false
+		}
+	}
+	if len(includeInstanceRes) == 0 {
+		return true
+	}
+	for _, re := range includeInstanceRes {
+		if re.MatchString(instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// instances listed in -o object(instanceA,instanceB), nil for an object
+// without instances or with a single instance
+func listedInstances(objectInstance string) []string {
+	start := strings.Index(objectInstance, "(")
+	if start == -1 || !strings.HasSuffix(objectInstance, ")") || !strings.Contains(objectInstance[start:], ",") {
+		return nil
+	}
+	instances := []string{}
+	for _, instance := range strings.Split(objectInstance[start+1:len(objectInstance)-1], ",") {
+		if instance = strings.TrimSpace(instance); instance != "" {
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
+
+// evaluate the -n counter of each instance listed in -o object(instanceA,instanceB)
+// against the thresholds of the node, the worst state is the result
+func queryInstances(counterEnvelope *CounterEnvelope, nodeIpAddr, object, counterName string, instances []string, failoverText string) *checkResult {
+	warning, critical := thresholdsForNode(nodeIpAddr)
+	if len(expectedValues()) > 0 {
+		warning, critical = "", ""
+	}
+	uom, factor := "", scaleFactor
+	if convertUnit != "" {
+		conversion, err := valueConversionOf(convertUnit)
+		if err != nil {
+			return &checkResult{node: nodeIpAddr, returnVal: 3, text: err.Error()}
+		}
+		uom, factor = conversion.uom, factor*conversion.factor
+	}
+
+	combinedReturnVal := 0
+	values, perfdata, longOutput := []string{}, []string{}, []string{}
+	for _, instance := range instances {
+		instanceCounter := fmt.Sprintf("%s(%s)\\%s", object, instance, counterName)
+		valueText, found := findCounterValue(counterEnvelope, getFullCounterName(nodeIpAddr, object+"("+instance+")", counterName))
+		if found && invalidValue(valueText) {
+			if invalidValueAs != "skip" {
+				combinedReturnVal = worseReturnVal(combinedReturnVal, invalidValueReturnVal())
+				values = append(values, fmt.Sprintf("%s=n/a", instance))
+				perfdata = append(perfdata, fmt.Sprintf("%s=U;%s;%s;;", instanceCounter, warning, critical))
+				longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s not available", instanceCounter, returnValText(invalidValueReturnVal()), valueText))
+			}
+			continue
+		}
+		value, err := strconv.ParseFloat(valueText, 64)
+		if !found || err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			values = append(values, fmt.Sprintf("%s=n/a", instance))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - instance not found", instanceCounter, returnValText(3)))
+			continue
+		}
+		if factor != 1 {
+			value *= factor
+			valueText = counterValueText(strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		returnVal := evaluateValue(value, warning, critical)
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		values = append(values, fmt.Sprintf("%s=%s%s", instance, valueText, uom))
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s%s;%s;%s;;", instanceCounter, valueText, uom, warning, critical))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s%s%s", instanceCounter, returnValText(returnVal), valueText, uom, expectText(value, returnVal)))
+	}
+
+	return &checkResult{
+		node:          nodeIpAddr,
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s,%s,%s: %s%s", outputPrefix, object, counterName, strings.Join(values, " "), failoverText),
+		instances:     objectInstances(counterEnvelope, nodeIpAddr, object),
+		warning:       warning,
+		critical:      critical,
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// true if the raw counter value is one of the -invalid-values sentinels
+// meaning not available, e.g. -1 or 4294967295 (unsigned -1)
+func invalidValue(valueText string) bool {
+	if invalidValueAs == "evaluate" {
+		return false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(valueText), 64)
+	if err != nil {
+		return false
+	}
+	for _, s := range strings.Split(invalidValues, ",") {
+		if sentinel, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && value == sentinel {
+			return true
+		}
+	}
+	return false
+}
+
+// return value of an invalid counter value by -invalid-value-as, OK for skip
+func invalidValueReturnVal() int {
+	if invalidValueAs == "unknown" {
+		return 3
+	}
+	return 0
+}
+
+func checkInvalidValueAs() error {
+	switch invalidValueAs {
+	case "evaluate", "unknown", "ok", "skip":
+		return nil
+	}
+	return fmt.Errorf("unknown -invalid-value-as: %s, use evaluate, unknown, ok or skip", invalidValueAs)
+}
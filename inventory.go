@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// model names by RisPort model number via AXL typemodel, cached like the counter catalog
+type ModelNames struct {
+	Names map[string]string
+}
+
+func deviceModelNames(ipAddr string) map[string]string {
+	cached := new(ModelNames)
+	if catalogCacheAge > 0 && loadStruct(ipAddr, "AXL typemodel", catalogCacheAge, cached) {
+		return cached.Names
+	}
+	rows, err := axlSQLQuery(ipAddr, "select enum, name from typemodel")
+	if err != nil {
+		debugPrintf(2, "AXL typemodel query failed, using model numbers: %s\n", err)
+		return map[string]string{}
+	}
+	cached.Names = map[string]string{}
+	for _, row := range rows {
+		cached.Names[row["enum"]] = row["name"]
+	}
+	if catalogCacheAge > 0 {
+		saveStruct(ipAddr, "AXL typemodel", cached)
+	}
+	return cached.Names
+}
+
+// perfdata label of a model or protocol name
+func inventoryLabel(prefix, name string) string {
+	return prefix + strings.Map(func(c rune) rune {
+		if c == ' ' || c == '=' || c == '\'' {
+			return '_'
+		}
+		return c
+	}, name)
+}
+
+// registered phones by model and protocol from RisPort. with -w or -c the
+// thresholds are the drop in percent of the registered phones of a model
+// since the previous run, e.g. -w 10 -c 30 after a firmware push.
+func checkInventory() *checkResult {
+	devices, err := risDevices(ipAddr, "Phone")
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+	modelNames := deviceModelNames(ipAddr)
+
+	models, protocols := map[string]int{}, map[string]int{}
+	registered := 0
+	for _, device := range devices {
+		if !risRegistered(device) {
+			continue
+		}
+		registered++
+		model := device.Model
+		if name, ok := modelNames[model]; ok {
+			model = name
+		}
+		models[model]++
+		protocols[device.Protocol]++
+	}
+
+	warning, critical := givenThresholds()
+	checkDrop := warning != "" || critical != ""
+	state := currentCheckState()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	entries := []listEntry{}
+
+	modelList := []string{}
+	for model := range models {
+		modelList = append(modelList, model)
+	}
+	if state != nil {
+		// models of the previous run missing now dropped by 100 percent
+		for key := range state.Data {
+			if model := strings.TrimPrefix(key, "inventory "); model != key && models[model] == 0 {
+				modelList = append(modelList, model)
+			}
+		}
+	}
+	sort.Strings(modelList)
+
+	for _, model := range modelList {
+		count := models[model]
+		line := fmt.Sprintf("%s: %d registered", model, count)
+		returnVal := 0
+		if state != nil {
+			key := "inventory " + model
+			if previous, err := strconv.Atoi(state.Data[key]); err == nil && previous > count && checkDrop {
+				drop := float64(previous-count) / float64(previous) * 100
+				line += fmt.Sprintf(", %.0f percent less than %d before", drop, previous)
+				returnVal = givenThresholdsReturnVal(drop, warning, critical)
+				if returnVal != 0 {
+					problems = append(problems, fmt.Sprintf("%s dropped from %d to %d", model, previous, count))
+				}
+			}
+			if count > 0 {
+				state.Data[key] = strconv.Itoa(count)
+			} else {
+				delete(state.Data, key)
+			}
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		entries = append(entries, listEntry{name: model, value: float64(count), line: line, perfdata: fmt.Sprintf("%s=%d;;;0;", inventoryLabel("model_", model), count)})
+	}
+	longOutput, modelPerfdata := sortLimitEntries(entries)
+
+	protocolList := []string{}
+	for protocol := range protocols {
+		protocolList = append(protocolList, protocol)
+	}
+	sort.Strings(protocolList)
+	protocolText := []string{}
+	for _, protocol := range protocolList {
+		protocolText = append(protocolText, fmt.Sprintf("%s %d", protocol, protocols[protocol]))
+		perfdata = append(perfdata, fmt.Sprintf("%s=%d;;;0;", inventoryLabel("protocol_", protocol), protocols[protocol]))
+	}
+	perfdata = append(perfdata, modelPerfdata...)
+
+	text := fmt.Sprintf("%s inventory %d registered phones, %d models (%s)", outputPrefix, registered, len(models), strings.Join(protocolText, ", "))
+	if len(problems) > 0 {
+		text += ": " + strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          text,
+		label:         "registered",
+		value:         strconv.Itoa(registered),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode inventory
+func dryRunInventory(object string) (*dryRunPlan, error) {
+	return dryRunRisPort("registered phones drop percent per model"), nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minimal Kafka producer: Metadata v1 to find the partition leader, SASL PLAIN
+// and Produce v3 with a record batch v2. messages are JSON metrics keyed by node.
+
+const (
+	kafkaProduceKey          = 0
+	kafkaMetadataKey         = 3
+	kafkaSaslHandshakeKey    = 17
+	kafkaSaslAuthenticateKey = 36
+	kafkaTimeout             = 10 * time.Second
+	kafkaClientID            = "check_cisco_uc_perf"
+)
+
+var kafkaCorrelationID int32
+
+// Kafka protocol request body writer
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8)   { e.WriteByte(byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int32(v int32) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int64(v int64) { binary.Write(e, binary.BigEndian, v) }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+func (e *kafkaEncoder) varint(v int64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	e.Write(buf[:binary.PutVarint(buf, v)])
+}
+
+// Kafka protocol response reader, the first error is kept
+type kafkaDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *kafkaDecoder) read(v interface{}) {
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.BigEndian, v)
+	}
+}
+
+func (d *kafkaDecoder) int16() (v int16) { d.read(&v); return }
+func (d *kafkaDecoder) int32() (v int32) { d.read(&v); return }
+func (d *kafkaDecoder) int64() (v int64) { d.read(&v); return }
+
+func (d *kafkaDecoder) bool() bool {
+	var v int8
+	d.read(&v)
+	return v != 0
+}
+
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 || d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	if d.err == nil {
+		_, d.err = io.ReadFull(d.r, b)
+	}
+	return string(b)
+}
+
+func (d *kafkaDecoder) skip(n int) {
+	if d.err == nil && n > 0 {
+		_, d.err = d.r.Seek(int64(n), io.SeekCurrent)
+	}
+}
+
+// connection to one Kafka broker
+type kafkaConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+func dialKafka(addr string) (*kafkaConn, error) {
+	dialer := &net.Dialer{Timeout: kafkaTimeout}
+	var conn net.Conn
+	var err error
+	if kafkaTLS {
+		tlsConfig := fipsTLSConfig(&tls.Config{})
+		if kafkaCA != "" {
+			pem, err := ioutil.ReadFile(kafkaCA)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no CA certificate found in %s", kafkaCA)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			tlsConfig.ServerName = host
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	c := &kafkaConn{conn: conn, rw: bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))}
+
+	if kafkaSaslUser != "" {
+		if err := c.saslPlain(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("SASL authentication failed: %s", err)
+		}
+	}
+	return c, nil
+}
+
+// send a request and return the response body after the correlation id
+func (c *kafkaConn) request(apiKey, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	kafkaCorrelationID++
+	header := &kafkaEncoder{}
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(kafkaCorrelationID)
+	header.string(kafkaClientID)
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(header.Len()+len(body)))
+	c.rw.Write(size)
+	c.rw.Write(header.Bytes())
+	c.rw.Write(body)
+	if err := c.rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(c.rw, size); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(c.rw, resp); err != nil {
+		return nil, err
+	}
+	d := &kafkaDecoder{r: bytes.NewReader(resp)}
+	if id := d.int32(); id != kafkaCorrelationID {
+		return nil, fmt.Errorf("unexpected correlation id %d", id)
+	}
+	return d, nil
+}
+
+// SaslHandshake v1 and SaslAuthenticate v0 with the PLAIN mechanism
+func (c *kafkaConn) saslPlain() error {
+	body := &kafkaEncoder{}
+	body.string("PLAIN")
+	d, err := c.request(kafkaSaslHandshakeKey, 1, body.Bytes())
+	if err != nil {
+		return err
+	}
+	if code := d.int16(); code != 0 {
+		return fmt.Errorf("handshake error code %d", code)
+	}
+
+	body = &kafkaEncoder{}
+	body.bytes([]byte("\x00" + kafkaSaslUser + "\x00" + kafkaSaslPassword))
+	d, err = c.request(kafkaSaslAuthenticateKey, 0, body.Bytes())
+	if err != nil {
+		return err
+	}
+	if code := d.int16(); code != 0 {
+		return fmt.Errorf("error code %d: %s", code, d.string())
+	}
+	return d.err
+}
+
+// leader broker address of every partition of the topic
+func (c *kafkaConn) partitionLeaders(topic string) (map[int32]string, error) {
+	body := &kafkaEncoder{}
+	body.int32(1)
+	body.string(topic)
+	d, err := c.request(kafkaMetadataKey, 1, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	brokers := map[int32]string{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+
+	leaders := map[int32]string{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := d.int16()
+		name := d.string()
+		d.bool() // internal
+		if code != 0 && name == topic {
+			return nil, fmt.Errorf("topic %s metadata error code %d", topic, code)
+		}
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			d.int16() // partition error
+			partition := d.int32()
+			leader := d.int32()
+			d.skip(int(d.int32()) * 4) // replicas
+			d.skip(int(d.int32()) * 4) // isr
+			if addr, ok := brokers[leader]; ok && name == topic {
+				leaders[partition] = addr
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(leaders) == 0 {
+		return nil, fmt.Errorf("no partition leader of topic %s", topic)
+	}
+	return leaders, nil
+}
+
+// record batch v2 of the messages
+func kafkaRecordBatch(keys, values [][]byte) []byte {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	records := &kafkaEncoder{}
+	for i := range values {
+		record := &kafkaEncoder{}
+		record.int8(0)   // attributes
+		record.varint(0) // timestamp delta
+		record.varint(int64(i))
+		record.varint(int64(len(keys[i])))
+		record.Write(keys[i])
+		record.varint(int64(len(values[i])))
+		record.Write(values[i])
+		record.varint(0) // headers
+		records.varint(int64(record.Len()))
+		records.Write(record.Bytes())
+	}
+
+	// attributes up to the records, covered by the CRC
+	tail := &kafkaEncoder{}
+	tail.int16(0) // attributes: no compression
+	tail.int32(int32(len(values) - 1))
+	tail.int64(now)
+	tail.int64(now)
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(int32(len(values)))
+	tail.Write(records.Bytes())
+
+	batch := &kafkaEncoder{}
+	batch.int64(0)                             // base offset
+	batch.int32(int32(4 + 1 + 4 + tail.Len())) // batch length
+	batch.int32(-1)                            // partition leader epoch
+	batch.int8(2)                              // magic
+	batch.int32(int32(crc32.Checksum(tail.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(tail.Bytes())
+	return batch.Bytes()
+}
+
+// Produce v3 of the messages to one partition, acknowledged by the leader
+func (c *kafkaConn) produce(topic string, partition int32, keys, values [][]byte) error {
+	body := &kafkaEncoder{}
+	body.int16(-1) // transactional id
+	body.int16(1)  // acks
+	body.int32(int32(kafkaTimeout / time.Millisecond))
+	body.int32(1)
+	body.string(topic)
+	body.int32(1)
+	body.int32(partition)
+	body.bytes(kafkaRecordBatch(keys, values))
+
+	d, err := c.request(kafkaProduceKey, 3, body.Bytes())
+	if err != nil {
+		return err
+	}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string()
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			d.int32()
+			if code := d.int16(); code != 0 {
+				return fmt.Errorf("produce error code %d", code)
+			}
+			d.int64() // base offset
+			d.int64() // log append time
+		}
+	}
+	return d.err
+}
+
+// publish the metrics as JSON messages to the -kafka-topic, the node is the
+// message key and selects the partition
+func produceKafka(metrics []metric) error {
+	var meta *kafkaConn
+	var err error
+	for _, broker := range strings.Split(kafkaBrokers, ",") {
+		if meta, err = dialKafka(strings.TrimSpace(broker)); err == nil {
+			break
+		}
+		debugPrintf(2, "Kafka broker %s error: %s\n", broker, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer meta.conn.Close()
+
+	leaders, err := meta.partitionLeaders(kafkaTopic)
+	if err != nil {
+		return err
+	}
+
+	type batch struct{ keys, values [][]byte }
+	batches := map[int32]*batch{}
+	for _, m := range metrics {
+		value, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		partition := int32(crc32.ChecksumIEEE([]byte(m.Node)) % uint32(len(leaders)))
+		if batches[partition] == nil {
+			batches[partition] = &batch{}
+		}
+		batches[partition].keys = append(batches[partition].keys, []byte(m.Node))
+		batches[partition].values = append(batches[partition].values, value)
+	}
+
+	for partition, b := range batches {
+		addr, ok := leaders[partition]
+		if !ok {
+			return fmt.Errorf("no leader of partition %d", partition)
+		}
+		conn, err := dialKafka(addr)
+		if err != nil {
+			return err
+		}
+		err = conn.produce(kafkaTopic, partition, b.keys, b.values)
+		conn.conn.Close()
+		if err != nil {
+			return err
+		}
+		debugPrintf(3, "%d messages produced to %s partition %d\n", len(b.values), kafkaTopic, partition)
+	}
+	return nil
+}
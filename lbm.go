@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// check the audio bandwidth of every location of the Cisco Locations LBM
+// object: -w and -c are the used percentage of BandwidthMaximum, new
+// OutOfResources events since the previous run are at least WARNING
+func checkLocations(nodes []string) *checkResult {
+	object := "Cisco Locations LBM"
+	if flagGiven("o") {
+		object = perfmonObject(objectInstance)
+	}
+
+	state := currentCheckState()
+	now := time.Now()
+	combinedReturnVal := 0
+	checked := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			continue
+		}
+
+		values := map[string]map[string]float64{}
+		for _, counter := range []string{"BandwidthMaximum", "BandwidthAvailable", "OutOfResources"} {
+			for _, v := range counterInstances(counterEnvelope, node, object, counter) {
+				if values[v.instance] == nil {
+					values[v.instance] = map[string]float64{}
+				}
+				values[v.instance][counter] = v.value
+			}
+		}
+		locations := []string{}
+		for location := range values {
+			locations = append(locations, location)
+		}
+		sort.Strings(locations)
+
+		for _, location := range locations {
+			v := values[location]
+			maximum, ok := v["BandwidthMaximum"]
+			// unlimited locations report no or a zero maximum
+			if !ok || maximum <= 0 {
+				continue
+			}
+			checked++
+			label := labelPrefix + location
+			used := maximum - v["BandwidthAvailable"]
+			usedPercent := used / maximum * 100
+			returnVal := getNagiosReturnVal(usedPercent, warningThreshold, criticalThreshold)
+			line := fmt.Sprintf("%s: %.0f of %.0f kbps used (%.1f%%)", label, used, maximum, usedPercent)
+
+			if outOfResources, ok := v["OutOfResources"]; ok && state != nil {
+				if rate, ok := counterRate(state, "lbm "+node+" "+location, outOfResources, now); ok && rate > 0 {
+					line += fmt.Sprintf(", OutOfResources %.2f/min", rate)
+					returnVal = worseReturnVal(returnVal, 1)
+				}
+				perfdata = append(perfdata, fmt.Sprintf("%s_out_of_resources=%sc;;;0;", label, strconv.FormatFloat(outOfResources, 'f', -1, 64)))
+			}
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s %.1f%% %s", label, usedPercent, returnValText(returnVal)))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			perfdata = append(perfdata,
+				fmt.Sprintf("%s_used_pct=%.1f;%s;%s;0;100", label, usedPercent, warningThreshold, criticalThreshold),
+				fmt.Sprintf("%s_available_kbps=%s;;;0;%s", label, strconv.FormatFloat(v["BandwidthAvailable"], 'f', -1, 64), strconv.FormatFloat(maximum, 'f', -1, 64)))
+			longOutput = append(longOutput, fmt.Sprintf("%s %s", line, returnValText(returnVal)))
+		}
+	}
+
+	summary := "bandwidth OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d locations: %s", outputPrefix, object, checked, summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode locations
+func dryRunLocations(object string) (*dryRunPlan, error) {
+	instance := objectInstance
+	if !flagGiven("o") {
+		object, instance = "Cisco Locations LBM", "Cisco Locations LBM(*)"
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, instance, "BandwidthAvailable", warningThreshold + " percent used", criticalThreshold + " percent used"},
+		{object, instance, "BandwidthMaximum", "", ""}, {object, instance, "OutOfResources", "increase", ""}}}, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// default thresholds of -mode memory: % VM Used, swap use in percent of the
+// swap size and the RTMT LowAvailableVirtualMemory alert (below 30% available)
+const (
+	memoryVMWarning        = "80"
+	memoryVMCritical       = "90"
+	memorySwapWarning      = "50"
+	memorySwapCritical     = "80"
+	memoryAvailableWarning = "30:"
+)
+
+// check the memory pressure indicators of the Memory object. -w and -c
+// override the % VM Used thresholds. high VM use together with swapping is
+// CRITICAL even if each indicator alone is only WARNING.
+func checkMemory(nodes []string) *checkResult {
+	vmWarning, vmCritical := memoryVMWarning, memoryVMCritical
+	if thresholdGiven("w") {
+		vmWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		vmCritical = criticalThreshold
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		counterEnvelope, _, err := collectCounterData(ipAddr, node, "Memory")
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+
+		values := map[string]float64{}
+		for _, counter := range []string{"% VM Used", "Used Swap KBytes", "Total Swap KBytes"} {
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, "Memory", counter))
+			if !found {
+				continue
+			}
+			if value, err := strconv.ParseFloat(valueText, 64); err == nil {
+				values[counter] = value
+			}
+		}
+		vmUsed, ok := values["% VM Used"]
+		if !ok {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %% VM Used n/a", node))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %% VM Used n/a", node, returnValText(3)))
+			continue
+		}
+
+		vmReturnVal := getNagiosReturnVal(vmUsed, vmWarning, vmCritical)
+		available := 100 - vmUsed
+		availableReturnVal := 0
+		if generateAlert(available, memoryAvailableWarning) {
+			availableReturnVal = 1
+		}
+		swapReturnVal := 0
+		swapUsed := 0.0
+		if values["Total Swap KBytes"] > 0 {
+			swapUsed = values["Used Swap KBytes"] / values["Total Swap KBytes"] * 100
+			swapReturnVal = getNagiosReturnVal(swapUsed, memorySwapWarning, memorySwapCritical)
+		}
+
+		returnVal := worseReturnVal(vmReturnVal, worseReturnVal(availableReturnVal, swapReturnVal))
+		nodeProblems := []string{}
+		if vmReturnVal != 0 {
+			nodeProblems = append(nodeProblems, fmt.Sprintf("VM used %.1f%% %s", vmUsed, returnValText(vmReturnVal)))
+		}
+		if availableReturnVal != 0 {
+			nodeProblems = append(nodeProblems, fmt.Sprintf("LowAvailableVirtualMemory %.1f%% available", available))
+		}
+		if swapReturnVal != 0 {
+			nodeProblems = append(nodeProblems, fmt.Sprintf("swap used %.1f%% %s", swapUsed, returnValText(swapReturnVal)))
+		}
+		if (vmReturnVal == 1 || availableReturnVal == 1) && swapReturnVal == 1 {
+			returnVal = 2
+			nodeProblems = append(nodeProblems, "memory pressure")
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		if len(nodeProblems) > 0 {
+			problems = append(problems, fmt.Sprintf("%s %s", node, strings.Join(nodeProblems, ", ")))
+		}
+
+		perfdata = append(perfdata,
+			fmt.Sprintf("%s/vm_used=%s;%s;%s;0;100", node, strconv.FormatFloat(vmUsed, 'f', -1, 64), vmWarning, vmCritical),
+			fmt.Sprintf("%s/vm_available=%.1f;%s;;0;100", node, available, memoryAvailableWarning),
+			fmt.Sprintf("%s/swap_used=%.1f;%s;%s;0;100", node, swapUsed, memorySwapWarning, memorySwapCritical),
+			fmt.Sprintf("%s/used_swap_kb=%s;;;0;%s", node, strconv.FormatFloat(values["Used Swap KBytes"], 'f', -1, 64), strconv.FormatFloat(values["Total Swap KBytes"], 'f', -1, 64)))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - VM used %.1f%%, %.1f%% available, swap used %.1f%% (%.0f of %.0f KBytes)", node, returnValText(returnVal), vmUsed, available, swapUsed, values["Used Swap KBytes"], values["Total Swap KBytes"]))
+	}
+
+	summary := "no memory pressure"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s memory %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode memory
+func dryRunMemory(object string) (*dryRunPlan, error) {
+	vmWarning, vmCritical := memoryVMWarning, memoryVMCritical
+	if thresholdGiven("w") {
+		vmWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		vmCritical = criticalThreshold
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{"Memory", "Memory", "% VM Used", vmWarning, vmCritical},
+		{"Memory", "Memory", "Used Swap KBytes", memorySwapWarning + " percent", memorySwapCritical + " percent"},
+		{"Memory", "Memory", "Total Swap KBytes", "", ""}}}, nil
+}
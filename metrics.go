@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// counter value published by the metrics output backends
+type metric struct {
+	Time     int64   `json:"time"`
+	Host     string  `json:"host"`
+	Node     string  `json:"node"`
+	Object   string  `json:"object,omitempty"`
+	Instance string  `json:"instance,omitempty"`
+	Counter  string  `json:"counter"`
+	Value    float64 `json:"value"`
+	Unit     string  `json:"unit,omitempty"`
+	Status   string  `json:"status"`
+}
+
+// metrics of a check result parsed from its perfdata. labels prefixed with
+// node/ belong to that node, all others to the node of the result.
+func resultMetrics(r *checkResult) []metric {
+	node := r.node
+	if node == "" {
+		node = nodeIpAddr
+	}
+	now := time.Now().Unix()
+	metrics := []metric{}
+	for _, p := range resultPerfdata(r) {
+		pos := strings.LastIndex(p, "=")
+		if pos == -1 {
+			continue
+		}
+		label, value := p[:pos], strings.SplitN(p[pos+1:], ";", 2)[0]
+		numEnd := strings.LastIndexAny(value, "0123456789.") + 1
+		v, err := strconv.ParseFloat(value[:numEnd], 64)
+		if err != nil {
+			continue
+		}
+		m := metric{Time: now, Host: ipAddr, Node: node, Counter: label, Value: v, Unit: value[numEnd:], Status: returnValText(r.returnVal)}
+		if slash := strings.Index(label, "/"); slash != -1 && !strings.Contains(label[:slash], "\\") {
+			m.Node, m.Counter = label[:slash], label[slash+1:]
+		}
+		// object check labels are object(instance)\counter, the modes summarize several objects
+		if checkMode == "" {
+			m.Instance = objectInstance
+		}
+		if pos := strings.LastIndex(m.Counter, "\\"); pos != -1 {
+			m.Instance, m.Counter = m.Counter[:pos], m.Counter[pos+1:]
+		}
+		m.Object = perfmonObject(m.Instance)
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// metrics output given with -output
+func outputEnabled(name string) bool {
+	for _, output := range strings.Split(metricsOutput, ",") {
+		if strings.TrimSpace(output) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validate the -output list
+func checkMetricsOutputs() error {
+	for _, output := range strings.Split(metricsOutput, ",") {
+		switch strings.TrimSpace(output) {
+		case "", "mqtt", "elasticsearch", "rrd":
+		case "kafka":
+			if kafkaBrokers == "" {
+				return fmt.Errorf("-output kafka requires -kafka-brokers")
+			}
+		default:
+			return fmt.Errorf("unknown output: %s", output)
+		}
+	}
+	return nil
+}
+
+// publish the metrics of a result to all configured output backends
+func publishMetrics(r *checkResult) {
+	if kafkaBrokers == "" && metricsOutput == "" {
+		return
+	}
+	metrics := resultMetrics(r)
+	if len(metrics) == 0 {
+		return
+	}
+	if kafkaBrokers != "" {
+		if err := produceKafka(metrics); err != nil {
+			debugPrintf(1, "Kafka error: %s\n", err)
+		}
+	}
+	if outputEnabled("mqtt") {
+		if err := publishMqtt(metrics); err != nil {
+			debugPrintf(1, "MQTT error: %s\n", err)
+		}
+	}
+	if outputEnabled("elasticsearch") {
+		if err := indexElasticsearch(metrics); err != nil {
+			debugPrintf(1, "Elasticsearch error: %s\n", err)
+		}
+	}
+	if outputEnabled("rrd") {
+		if err := updateRRDs(metrics); err != nil {
+			debugPrintf(1, "RRD error: %s\n", err)
+		}
+	}
+}
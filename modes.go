@@ -0,0 +1,48 @@
+package main
+
+// check and -dry-run plan of a -mode. the entries of checkModes are
+// positional, so a mode without dry run plan doesn't compile.
+type checkModeFuncs struct {
+	check  func(nodes []string, object string) *checkResult
+	dryRun func(object string) (*dryRunPlan, error)
+}
+
+// checks of the nodes, ignoring the object
+func nodesCheck(check func(nodes []string) *checkResult) func([]string, string) *checkResult {
+	return func(nodes []string, object string) *checkResult { return check(nodes) }
+}
+
+// checks of the cluster or server itself, ignoring the nodes and the object
+func serverCheck(check func() *checkResult) func([]string, string) *checkResult {
+	return func(nodes []string, object string) *checkResult { return check() }
+}
+
+// the -mode values, -health and -rtmt select the modes health and rtmt
+var checkModes = map[string]checkModeFuncs{
+	"health":        {nodesCheck(checkHealth), dryRunHealth},
+	"score":         {nodesCheck(checkScore), dryRunScore},
+	"cpu":           {nodesCheck(checkCPU), dryRunCPU},
+	"memory":        {nodesCheck(checkMemory), dryRunMemory},
+	"heartbeat":     {nodesCheck(checkHeartbeat), dryRunHeartbeat},
+	"uptime":        {nodesCheck(checkUptime), dryRunUptime},
+	"cluster-calls": {nodesCheck(checkClusterCalls), dryRunClusterCalls},
+	"route-list":    {nodesCheck(checkRouteLists), dryRunRouteLists},
+	"locations":     {nodesCheck(checkLocations), dryRunLocations},
+	"device-pools":  {serverCheck(checkDevicePools), dryRunDevicePools},
+	"inventory":     {serverCheck(checkInventory), dryRunInventory},
+	"registrations": {nodesCheck(checkRegistrations), dryRunRegistrations},
+	"hunt":          {nodesCheck(checkHuntPilots), dryRunHuntPilots},
+	"presence":      {nodesCheck(checkPresence), dryRunPresence},
+	"tftp":          {nodesCheck(checkTFTP), dryRunTFTP},
+	"cdr":           {nodesCheck(checkCDR), dryRunCDR},
+	"tomcat":        {nodesCheck(checkTomcat), dryRunTomcat},
+	"availability":  {nodesCheck(checkAvailability), dryRunAvailability},
+	"stuck":         {checkStuck, dryRunStuck},
+	"call-quality":  {serverCheck(checkCallQuality), dryRunCallQuality},
+	"ils":           {nodesCheck(checkILS), dryRunILS},
+	"sso":           {nodesCheck(checkSSO), dryRunSSO},
+	"smart-license": {serverCheck(checkSmartLicense), dryRunSmartLicense},
+	"rtmt":          {nodesCheck(checkRTMT), dryRunRTMT},
+	"api-rtt":       {serverCheck(checkAPIResponseTime), dryRunAPIResponseTime},
+	"expressway":    {serverCheck(checkExpressway), dryRunExpressway},
+}
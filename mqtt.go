@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// minimal MQTT 3.1.1 publisher: CONNECT, PUBLISH with QoS 0 or 1 and DISCONNECT
+
+const mqttTimeout = 10 * time.Second
+
+// MQTT control packet with the remaining length prefix
+func mqttPacket(packetType byte, body []byte) []byte {
+	b := []byte{packetType}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+func mqttString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+// read one control packet, returns type and body
+func mqttRead(r *bufio.Reader) (byte, []byte, error) {
+	packetType, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, uint(0)
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(digit&0x7f) << shift
+		shift += 7
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return packetType, body, err
+}
+
+// MQTT topic of a metric from the -mqtt-topic template. the wildcards + and #
+// are not allowed in published topics and replaced with _.
+func mqttTopic(tmpl *template.Template, m metric) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, m); err != nil {
+		return "", err
+	}
+	return strings.NewReplacer("+", "_", "#", "_").Replace(b.String()), nil
+}
+
+func dialMqtt() (net.Conn, error) {
+	u, err := url.Parse(mqttBroker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker URL: %s", mqttBroker)
+	}
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Host, "1883")
+		}
+		return dialer.Dial("tcp", addr)
+	case "ssl", "tls", "mqtts":
+		tlsConfig := fipsTLSConfig(&tls.Config{ServerName: u.Hostname()})
+		if mqttCA != "" {
+			pem, err := ioutil.ReadFile(mqttCA)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no CA certificate found in %s", mqttCA)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Host, "8883")
+		}
+		return tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	}
+	return nil, fmt.Errorf("unsupported MQTT broker URL scheme: %s", u.Scheme)
+}
+
+// publish the counter values to the -mqtt-broker, one message per metric
+func publishMqtt(metrics []metric) error {
+	tmpl, err := template.New("topic").Parse(mqttTopicTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT topic template: %s", err)
+	}
+	if mqttQoS != 0 && mqttQoS != 1 {
+		return fmt.Errorf("unsupported MQTT QoS %d, use 0 or 1", mqttQoS)
+	}
+
+	conn, err := dialMqtt()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	r := bufio.NewReader(conn)
+
+	connect := &bytes.Buffer{}
+	mqttString(connect, "MQTT")
+	flags := byte(0x02) // clean session
+	if mqttUser != "" {
+		flags |= 0x80
+		if mqttPassword != "" {
+			flags |= 0x40
+		}
+	}
+	connect.Write([]byte{4, flags, 0, 30}) // protocol level 3.1.1, flags, keep alive 30s
+	mqttString(connect, mqttClientID)
+	if mqttUser != "" {
+		mqttString(connect, mqttUser)
+		if mqttPassword != "" {
+			mqttString(connect, mqttPassword)
+		}
+	}
+	if _, err := conn.Write(mqttPacket(0x10, connect.Bytes())); err != nil {
+		return err
+	}
+	packetType, body, err := mqttRead(r)
+	if err != nil {
+		return err
+	}
+	if packetType != 0x20 || len(body) < 2 {
+		return fmt.Errorf("unexpected MQTT packet type %d instead of CONNACK", packetType>>4)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("MQTT connection refused, return code %d", body[1])
+	}
+
+	for i, m := range metrics {
+		topic, err := mqttTopic(tmpl, m)
+		if err != nil {
+			return err
+		}
+		publish := &bytes.Buffer{}
+		mqttString(publish, topic)
+		packetID := uint16(i + 1)
+		if mqttQoS == 1 {
+			binary.Write(publish, binary.BigEndian, packetID)
+		}
+		publish.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+		if _, err := conn.Write(mqttPacket(0x30|byte(mqttQoS<<1), publish.Bytes())); err != nil {
+			return err
+		}
+		if mqttQoS == 1 {
+			packetType, body, err := mqttRead(r)
+			if err != nil {
+				return err
+			}
+			if packetType != 0x40 || len(body) < 2 || binary.BigEndian.Uint16(body) != packetID {
+				return fmt.Errorf("missing MQTT PUBACK of %s", topic)
+			}
+		}
+		debugPrintf(3, "MQTT published %s %v\n", topic, m.Value)
+	}
+
+	_, err = conn.Write(mqttPacket(0xe0, nil))
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// boundaries of a threshold range, e.g. 10, 10:, ~:10, 5:10 or @5:10
+func thresholdBounds(thresholdRange string) []float64 {
+	bounds := []float64{}
+	for _, s := range strings.Split(strings.TrimPrefix(thresholdRange, "@"), ":") {
+		if bound, err := strconv.ParseFloat(s, 64); err == nil {
+			bounds = append(bounds, bound)
+		}
+	}
+	return bounds
+}
+
+// true if the value doesn't alert on the threshold range but is within
+// percent of one of its boundaries
+func nearThreshold(value float64, thresholdRange string, percent float64) bool {
+	if thresholdRange == "" || generateAlert(value, thresholdRange) {
+		return false
+	}
+	for _, bound := range thresholdBounds(thresholdRange) {
+		if math.Abs(value-bound) <= math.Abs(bound)*percent/100 {
+			return true
+		}
+	}
+	return false
+}
+
+// -show-near-threshold long output line of a counter within the percent of
+// the next threshold it would alert on, empty if not near or critical
+func nearThresholdText(label, valueText string, value float64, returnVal int, warning, critical string) string {
+	switch {
+	case returnVal == 0 && nearThreshold(value, warning, nearThresholdPercent):
+		return fmt.Sprintf("near warning: %s=%s (warning %s, critical %s)", label, valueText, warning, critical)
+	case returnVal < 2 && nearThreshold(value, critical, nearThresholdPercent):
+		return fmt.Sprintf("near critical: %s=%s (warning %s, critical %s)", label, valueText, warning, critical)
+	}
+	return ""
+}
+
+// -show-near-threshold lines of the other instances of the -n counter of the
+// object, they share the thresholds of the evaluated counter
+func nearThresholdInstancesText(counterEnvelope *CounterEnvelope, nodeIpAddr, object, counterName, evaluatedInstance, warning, critical string) []string {
+	lines := []string{}
+	for _, v := range counterInstances(counterEnvelope, nodeIpAddr, object, counterName) {
+		instance := object + "(" + v.instance + ")"
+		if instance == evaluatedInstance {
+			continue
+		}
+		if line := nearThresholdText(instance+"\\"+counterName, v.text, v.value, getNagiosReturnVal(v.value, warning, critical), warning, critical); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
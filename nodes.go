@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// read a list file with one entry per line. empty lines and comments
+// starting with # at the beginning of a line or after whitespace are skipped.
+func readListFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for pos, c := range line {
+			if c == '#' && (pos == 0 || line[pos-1] == ' ' || line[pos-1] == '\t') {
+				line = line[:pos]
+				break
+			}
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// nodes given by -M, either a comma separated list or @filename of a node list file.
+// the file is read on every run so node changes don't require command redefinitions.
+func getNodes() ([]string, error) {
+	if strings.HasPrefix(nodesIpAddrs, "@") {
+		return readListFile(strings.TrimPrefix(nodesIpAddrs, "@"))
+	}
+	return strings.Split(nodesIpAddrs, ","), nil
+}
+
+// parse -node-thresholds: node=warning,critical entries separated by ; or whitespace,
+// or @filename of a file with one entry per line
+func parseNodeThresholds(spec string) (map[string][2]string, error) {
+	thresholds := map[string][2]string{}
+	if spec == "" {
+		return thresholds, nil
+	}
+
+	entries := []string{}
+	if strings.HasPrefix(spec, "@") {
+		lines, err := readListFile(strings.TrimPrefix(spec, "@"))
+		if err != nil {
+			return nil, err
+		}
+		entries = lines
+	} else {
+		entries = strings.FieldsFunc(spec, func(c rune) bool { return c == ';' || c == ' ' || c == '\t' })
+	}
+
+	for _, entry := range entries {
+		pos := strings.Index(entry, "=")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid node threshold %q, expected node=warning,critical", entry)
+		}
+		values := strings.Split(strings.TrimSpace(entry[pos+1:]), ",")
+		if len(values) != 2 {
+			return nil, fmt.Errorf("invalid node threshold %q, expected node=warning,critical", entry)
+		}
+		thresholds[strings.TrimSpace(entry[:pos])] = [2]string{strings.TrimSpace(values[0]), strings.TrimSpace(values[1])}
+	}
+	return thresholds, nil
+}
+
+// warning and critical threshold of a node, -w and -c unless overridden by -node-thresholds
+func thresholdsForNode(node string) (string, string) {
+	if t, ok := nodeThresholds[node]; ok {
+		return t[0], t[1]
+	}
+	return warningThreshold, criticalThreshold
+}
+
+// summary of the node results of a multi-node check, the states other than OK
+// name the nodes and their values, e.g. "8 nodes: 7 OK, 1 WARNING (cucm-sub3: CallsActive=812)"
+func nodeSummaryText(results []*checkResult) string {
+	byState := map[int][]string{}
+	for _, r := range results {
+		detail := r.node
+		if r.label != "" {
+			detail = fmt.Sprintf("%s: %s=%s%s", r.node, strings.TrimPrefix(r.label, r.node+"/"), r.value, r.uom)
+		}
+		byState[r.returnVal] = append(byState[r.returnVal], detail)
+	}
+	summary := []string{}
+	for _, rv := range []int{0, 1, 2, 3} {
+		switch {
+		case len(byState[rv]) == 0:
+		case rv == 0:
+			summary = append(summary, fmt.Sprintf("%d %s", len(byState[rv]), returnValText(rv)))
+		default:
+			summary = append(summary, fmt.Sprintf("%d %s (%s)", len(byState[rv]), returnValText(rv), strings.Join(byState[rv], ", ")))
+		}
+	}
+	nodes := "nodes"
+	if len(results) == 1 {
+		nodes = "node"
+	}
+	return fmt.Sprintf("%d %s: %s", len(results), nodes, strings.Join(summary, ", "))
+}
+
+// query the counter on every node and combine the results to one output: the
+// most severe state, a summary naming the offending nodes, the node results in
+// long output and the perfdata qualified with the node. nodes without the
+// counter are skipped unless no node has it.
+func checkNodes(nodes []string, object string) *checkResult {
+	combinedReturnVal := 0
+	results := []*checkResult{}
+	perfdata := []string{}
+	longOutput := []string{}
+	children := []childResult{}
+	empty := 0
+
+	for _, node := range nodes {
+		r := queryHost(ipAddr, node, object, counterName, objectInstance)
+		if r.empty {
+			empty++
+		}
+		if r.notFound {
+			debugPrintf(3, "node %s skipped: %s\n", node, r.text)
+			longOutput = append(longOutput, fmt.Sprintf("%s: skipped - %s", node, r.text))
+			continue
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, r.returnVal)
+		results = append(results, r)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(r.returnVal), r.text))
+		for _, line := range r.longOutput {
+			longOutput = append(longOutput, node+": "+line)
+		}
+		children = append(children, childResult{name: node, returnVal: r.returnVal, text: r.text, longOutput: r.longOutput})
+		qualifyPerfdata(r, node+"/")
+		perfdata = append(perfdata, resultPerfdata(r)...)
+	}
+
+	switch {
+	case empty == len(nodes):
+		return &checkResult{returnVal: 3, text: emptyCounterDataText(nodes, object)}
+	case len(results) == 0:
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("Counter not found on any node: %s", counterName)}
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s,%s,%s %s", outputPrefix, objectInstance, counterName, nodeSummaryText(results)),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+		children:      children,
+	}
+}
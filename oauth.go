@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuth2 token of -oauth-token-url, cached until it expires
+type oauthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Expiry       int64  `json:"expiry"`
+}
+
+// token used for the requests of this run
+var currentToken *oauthToken
+
+// cache file of the token, readable by the owner only
+func oauthTokenFile() string {
+	id := fmt.Sprintf("%x", md5.Sum([]byte(oauthTokenURL+"\x00"+oauthClientID+"\x00"+username)))
+	return cacheFileName(id, "oauth_token")
+}
+
+// request a token from the token endpoint, with the refresh token if there is one
+func requestToken(refreshToken string) (*oauthToken, error) {
+	form := url.Values{}
+	switch {
+	case refreshToken != "":
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", refreshToken)
+	case oauthGrant == "password":
+		form.Set("grant_type", "password")
+		form.Set("username", username)
+		form.Set("password", password)
+	case oauthGrant == "client_credentials":
+		form.Set("grant_type", "client_credentials")
+	default:
+		return nil, fmt.Errorf("unsupported OAuth2 grant type: %s", oauthGrant)
+	}
+	if oauthScope != "" {
+		form.Set("scope", oauthScope)
+	}
+
+	req, err := http.NewRequest("POST", oauthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(oauthClientID), url.QueryEscape(oauthClientSecret))
+
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("token response error: %s", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return nil, fmt.Errorf("token response without access_token")
+	}
+	if tokenResponse.ExpiresIn <= 0 {
+		tokenResponse.ExpiresIn = 300
+	}
+	token := &oauthToken{AccessToken: tokenResponse.AccessToken, RefreshToken: tokenResponse.RefreshToken, Expiry: time.Now().Unix() + tokenResponse.ExpiresIn}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// access token for the Bearer header. a cached token is used until 30 seconds
+// before it expires, forceRefresh discards it after the server rejected it.
+func bearerToken(forceRefresh bool) (string, error) {
+	filename := oauthTokenFile()
+	if currentToken == nil && !forceRefresh {
+		if data, err := ioutil.ReadFile(filename); err == nil {
+			token := new(oauthToken)
+			if json.Unmarshal(data, token) == nil {
+				currentToken = token
+			}
+		}
+	}
+
+	if currentToken != nil && !forceRefresh && currentToken.Expiry-30 > time.Now().Unix() {
+		addSecret("", currentToken.AccessToken)
+		return currentToken.AccessToken, nil
+	}
+
+	var token *oauthToken
+	var err error
+	if currentToken != nil && currentToken.RefreshToken != "" {
+		addSecret("", currentToken.RefreshToken)
+		if token, err = requestToken(currentToken.RefreshToken); err != nil {
+			debugPrintf(2, "OAuth2 token refresh failed: %s\n", err)
+		}
+	}
+	if token == nil {
+		if token, err = requestToken(""); err != nil {
+			return "", fmt.Errorf("OAuth2 token error: %s", err)
+		}
+	}
+	addSecret("", token.AccessToken)
+	addSecret("", token.RefreshToken)
+	currentToken = token
+	debugPrintf(3, "OAuth2 token obtained, expires %s\n", time.Unix(token.Expiry, 0))
+
+	data, _ := json.Marshal(token)
+	if err := writeFileAtomic(filename, data, 0600); err != nil {
+		debugPrintf(1, "OAuth2 token cache error: %s\n", err)
+	}
+	return token.AccessToken, nil
+}
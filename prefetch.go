@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// collect and cache the -prefetch objects of all nodes, so the following checks
+// find a warm cache. returns UNKNOWN if any object could not be collected.
+func prefetch(nodes []string) int {
+	objects := []string{}
+	if strings.HasPrefix(prefetchObjects, "@") {
+		lines, err := readListFile(strings.TrimPrefix(prefetchObjects, "@"))
+		if err != nil {
+			fmt.Printf("%s - Can't read prefetch object list file: %s\n", returnValText(3), err)
+			return 3
+		}
+		objects = lines
+	} else {
+		for _, object := range strings.Split(prefetchObjects, ",") {
+			if object = strings.TrimSpace(object); object != "" {
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	failed := []string{}
+	for _, node := range nodes {
+		for _, object := range objects {
+			if _, _, err := fetchCounterData(ipAddr, node, object); err != nil {
+				failed = append(failed, fmt.Sprintf("%s %s: %s", node, object, err))
+				continue
+			}
+			debugPrintf(3, "prefetched %s %s\n", node, object)
+		}
+	}
+
+	returnVal := 0
+	if len(failed) > 0 {
+		returnVal = 3
+	}
+	fmt.Printf("%s - %s prefetched %d of %d objects of %d nodes\n", returnValText(returnVal), outputPrefix, len(nodes)*len(objects)-len(failed), len(nodes)*len(objects), len(nodes))
+	for _, f := range failed {
+		fmt.Printf("%s\n", escapeOutput(f))
+	}
+	return returnVal
+}
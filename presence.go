@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IM and Presence counter of -mode presence, rate counters are evaluated as
+// increase per minute since the previous run
+type presenceCounter struct {
+	name        string
+	object      string
+	counterName string
+	rate        bool
+}
+
+var presenceCounters = []presenceCounter{
+	{"subscriptions", "Cisco Presence Engine", "ActiveSubscriptions", false},
+	{"jsm_sessions", "Cisco XCP JSM", "JsmSessions", false},
+	{"proxy_errors", "Cisco SIP Proxy", "RequestsFailed", true},
+}
+
+// check the Presence Engine subscriptions, XCP JSM sessions and SIP proxy
+// errors of every IM and Presence node. -w and -c apply to the subscriptions,
+// -presence-thresholds name=warning,critical to every counter. counters
+// without thresholds are only reported.
+func checkPresence(nodes []string) *checkResult {
+	thresholds, err := parseNodeThresholds(presenceThresholdList)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+	if warning, critical := givenThresholds(); warning != "" || critical != "" {
+		if _, ok := thresholds["subscriptions"]; !ok {
+			thresholds["subscriptions"] = [2]string{warning, critical}
+		}
+	}
+	for name := range thresholds {
+		known := false
+		for _, c := range presenceCounters {
+			known = known || c.name == name
+		}
+		if !known {
+			return &checkResult{returnVal: 3, text: fmt.Sprintf("unknown presence counter: %s, use subscriptions, jsm_sessions or proxy_errors", name)}
+		}
+	}
+
+	state := currentCheckState()
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		envelopes := map[string]*CounterEnvelope{}
+
+		for _, c := range presenceCounters {
+			counterEnvelope, ok := envelopes[c.object]
+			if !ok {
+				// rates need the current value
+				if c.rate {
+					counterEnvelope, _, err = fetchCounterData(ipAddr, node, c.object)
+				} else {
+					counterEnvelope, _, err = collectCounterData(ipAddr, node, c.object)
+				}
+				if err != nil {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					problems = append(problems, fmt.Sprintf("%s %s", node, err))
+					longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+					break
+				}
+				envelopes[c.object] = counterEnvelope
+			}
+
+			label := labelPrefix + c.name
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, c.object, c.counterName))
+			value, err := strconv.ParseFloat(valueText, 64)
+			if !found || err != nil {
+				longOutput = append(longOutput, fmt.Sprintf("%s %s\\%s n/a", label, c.object, c.counterName))
+				continue
+			}
+
+			if c.rate {
+				perfdata = append(perfdata, fmt.Sprintf("%s=%sc;;;0;", label, valueText))
+				if state == nil {
+					longOutput = append(longOutput, fmt.Sprintf("%s %s total", label, valueText))
+					continue
+				}
+				rate, ok := counterRate(state, "presence "+node+" "+c.name, value, now)
+				if !ok {
+					longOutput = append(longOutput, fmt.Sprintf("%s %s total, rate n/a, first run", label, valueText))
+					continue
+				}
+				value, valueText = rate, strconv.FormatFloat(rate, 'f', 2, 64)
+				label += "_per_min"
+			}
+
+			warning, critical := "", ""
+			returnVal := 0
+			if t, ok := thresholds[c.name]; ok {
+				warning, critical = t[0], t[1]
+				returnVal = givenThresholdsReturnVal(value, warning, critical)
+			}
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s=%s %s", label, valueText, returnValText(returnVal)))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;%s;0;", label, valueText, warning, critical))
+			longOutput = append(longOutput, fmt.Sprintf("%s %s %s", label, valueText, returnValText(returnVal)))
+		}
+	}
+
+	summary := "presence OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s IM and Presence %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode presence
+func dryRunPresence(object string) (*dryRunPlan, error) {
+	thresholds, err := parseNodeThresholds(presenceThresholdList)
+	if err != nil {
+		return nil, err
+	}
+	if warning, critical := givenThresholds(); warning != "" || critical != "" {
+		if _, ok := thresholds["subscriptions"]; !ok {
+			thresholds["subscriptions"] = [2]string{warning, critical}
+		}
+	}
+	plan := &dryRunPlan{}
+	for _, c := range presenceCounters {
+		q := dryRunQuery{c.object, c.object, c.counterName, thresholds[c.name][0], thresholds[c.name][1]}
+		if c.rate && q.warning != "" {
+			q.warning += " per minute"
+		}
+		if c.rate && q.critical != "" {
+			q.critical += " per minute"
+		}
+		plan.queries = append(plan.queries, q)
+	}
+	return plan, nil
+}
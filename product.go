@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// default objects, health indicators and known perfmon objects of a product
+// serving the PerfmonPort service
+type productProfile struct {
+	defaultObject string
+	scoreWeights  string
+	objects       []string // known objects, others are reported as debug warning
+	health        []healthIndicator
+	axl           bool // AXL node discovery available
+}
+
+// objects of the VOS platform, available on every product
+var platformObjects = []string{"Memory", "Processor", "Partition", "System", "Network Interface", "IP", "TCP", "Thread", "Process", "Number of Replicates Created and State of Replication"}
+
+var productProfiles = map[string]productProfile{
+	"cucm": {
+		defaultObject: "Memory",
+		scoreWeights:  defaultScoreWeights,
+		objects:       []string{"Cisco CallManager", "Cisco SIP", "Cisco SIP Stack", "Cisco Locations LBM", "Cisco Tftp", "Cisco Phones", "Cisco Hunt Lists", "Cisco Hunt Pilots", "Cisco Route Lists", "Cisco Lines", "Cisco MGCP Gateways", "Cisco H323", "Cisco Media Streaming App", "Cisco Tomcat JVM", "Cisco CAR DB", "Cisco CDR Agent", "Cisco ILS", "Cisco Annunciator Device", "Cisco Transcode Device", "Cisco MOH Device"},
+		health:        healthIndicators,
+		axl:           true,
+	},
+	"imp": {
+		defaultObject: "Cisco Presence Engine",
+		scoreWeights:  defaultScoreWeights,
+		objects:       []string{"Cisco Presence Engine", "Cisco XCP JSM", "Cisco XCP CM", "Cisco XCP Router", "Cisco SIP Proxy", "Cisco Server Recovery Manager", "Cisco Tomcat JVM"},
+		health: []healthIndicator{
+			healthIndicators[0], // cpu
+			healthIndicators[1], // memory
+			healthIndicators[2], // disk_active
+			healthIndicators[3], // disk_common
+			healthIndicators[4], // replication
+			{"subscriptions", "Cisco Presence Engine", "Cisco Presence Engine", "ActiveSubscriptions", "", ""},
+			{"jsm_sessions", "Cisco XCP JSM", "Cisco XCP JSM", "JsmSessions", "", ""},
+		},
+	},
+	"cer": {
+		defaultObject: "Cisco Emergency Responder",
+		scoreWeights:  "cpu=3,memory=2,disk_active=2,disk_common=1,subscriber=2",
+		objects:       []string{"Cisco Emergency Responder", "Cisco ER Onsite Alert", "Cisco ER Licenses", "Cisco Tomcat JVM"},
+		health: []healthIndicator{
+			healthIndicators[0], // cpu
+			healthIndicators[1], // memory
+			healthIndicators[2], // disk_active
+			healthIndicators[3], // disk_common
+			{"subscriber", "Cisco Emergency Responder", "Cisco Emergency Responder", "SubscriberConnected", "1:", "1:"},
+			{"onsite_alerts_failed", "Cisco ER Onsite Alert", "Cisco ER Onsite Alert", "OnsiteAlertsFailed", "1", "5"},
+			{"licenses_used", "Cisco ER Licenses", "Cisco ER Licenses", "% Licenses Used", "80", "90"},
+			{"emergency_calls", "Cisco Emergency Responder", "Cisco Emergency Responder", "EmergencyCallsRouted", "", ""},
+		},
+	},
+}
+
+// true if the flag was given on the command line
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// apply the defaults of -product and validate the options against it
+func applyProduct() error {
+	profile, ok := productProfiles[product]
+	if !ok {
+		return fmt.Errorf("unknown product: %s", product)
+	}
+
+	if !flagGiven("o") {
+		objectInstance = profile.defaultObject
+	}
+	if !flagGiven("score-weights") {
+		scoreWeights = profile.scoreWeights
+	}
+	healthIndicators = profile.health
+
+	if allNodes && !profile.axl {
+		return fmt.Errorf("-all-nodes needs AXL, not available for product %s", product)
+	}
+
+	known := perfmonObject(objectInstance) == ""
+	for _, o := range append(platformObjects, profile.objects...) {
+		if strings.EqualFold(o, perfmonObject(objectInstance)) {
+			known = true
+		}
+	}
+	if !known {
+		debugPrintf(2, "object %s is not a known %s object\n", perfmonObject(objectInstance), product)
+	}
+	return nil
+}
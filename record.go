@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// number of request/response pairs recorded by this run
+var recordCount int
+
+// save a sanitized request/response pair to the -record directory. the response
+// file holds the unmodified body apart from masked secrets and can be used with -replay.
+func recordExchange(url, soapAction, request, status string, body []byte) {
+	if err := os.MkdirAll(recordDir, 0755); err != nil {
+		debugPrintf(1, "record error: %s\n", err)
+		return
+	}
+	recordCount++
+	name := filepath.Join(recordDir, fmt.Sprintf("%s_%d_%02d_%s", time.Now().Format("20060102T150405"), os.Getpid(), recordCount, path.Base(url)))
+
+	requestText := fmt.Sprintf("POST %s\nContent-type: text/xml\nSOAPAction: %s\n# response: %s\n\n%s\n", url, soapAction, status, request)
+	if err := ioutil.WriteFile(name+"_request.txt", []byte(redact(requestText)), 0644); err != nil {
+		debugPrintf(1, "record error: %s\n", err)
+	}
+	if err := ioutil.WriteFile(name+"_response.xml", []byte(redact(string(body))), 0644); err != nil {
+		debugPrintf(1, "record error: %s\n", err)
+	}
+	debugPrintf(2, "recorded %s\n", name)
+}
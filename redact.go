@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// secrets masked in all log and debug output, guarded by secretsMutex as
+// the -serve handlers log concurrently
+var (
+	secrets      = []string{}
+	secretsMutex sync.RWMutex
+)
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(authorization:\s*(?:basic|bearer)\s+)\S+`),
+	regexp.MustCompile(`(?i)((?:jsessionidsso|jsessionid)=)[^;\s"]+`),
+	regexp.MustCompile(`(?i)(password\s*[=:]\s*)\S+`),
+}
+
+// log writer masking secrets, passwords, authorization headers and session cookies
+type redactWriter struct {
+	w io.Writer
+}
+
+// register a secret to be masked, also in its basic auth encoded form
+func addSecret(user, secret string) {
+	if secret == "" {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	secrets = append(secrets, secret, base64.StdEncoding.EncodeToString([]byte(user+":"+secret)))
+}
+
+func redact(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, "****", -1)
+	}
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}****")
+	}
+	return s
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// station registrations of a protocol, counted by a perfmon counter
+type protocolCounter struct {
+	protocol          string
+	object            string
+	counterName       string
+	warning, critical string
+}
+
+// parse -protocol-counters Protocol=Object\Counter,... and the
+// -protocol-thresholds Protocol=warning,critical;... ranges
+func parseProtocolCounters(counters, thresholds string) ([]protocolCounter, error) {
+	protocols := []protocolCounter{}
+	for _, entry := range strings.Split(counters, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pos := strings.Index(entry, "=")
+		slash := strings.LastIndex(entry, "\\")
+		if pos == -1 || slash < pos {
+			return nil, fmt.Errorf("invalid protocol counter: %s, use protocol=object\\counter", entry)
+		}
+		protocols = append(protocols, protocolCounter{protocol: entry[:pos], object: entry[pos+1 : slash], counterName: entry[slash+1:]})
+	}
+
+	for _, entry := range strings.Split(thresholds, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pos := strings.Index(entry, "=")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid protocol thresholds: %s, use protocol=warning,critical", entry)
+		}
+		ranges := strings.SplitN(entry[pos+1:], ",", 2)
+		found := false
+		for i := range protocols {
+			if strings.EqualFold(protocols[i].protocol, entry[:pos]) {
+				protocols[i].warning = ranges[0]
+				if len(ranges) == 2 {
+					protocols[i].critical = ranges[1]
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("protocol thresholds for unknown protocol: %s", entry[:pos])
+		}
+	}
+	return protocols, nil
+}
+
+// compare the registered stations per protocol with their own thresholds.
+// the counters are summed over all nodes as every subscriber only counts its
+// own registrations, the -w and -c thresholds apply to the total of the
+// RegisteredHardwarePhones and RegisteredOtherStationDevices counters if given.
+func checkRegistrations(nodes []string) *checkResult {
+	protocols, err := parseProtocolCounters(protocolCounters, protocolThresholds)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	totalCounters := []string{"RegisteredHardwarePhones", "RegisteredOtherStationDevices"}
+	sums := map[string]float64{}
+	found := map[string]bool{}
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		envelopes := map[string]*CounterEnvelope{}
+		value := func(object, counter string) (float64, bool) {
+			counterEnvelope, ok := envelopes[object]
+			if !ok {
+				counterEnvelope, _, err = collectCounterData(ipAddr, node, object)
+				if err != nil {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					problems = append(problems, fmt.Sprintf("%s %s", node, err))
+				}
+				envelopes[object] = counterEnvelope
+			}
+			if counterEnvelope == nil {
+				return 0, false
+			}
+			valueText, ok := findCounterValue(counterEnvelope, getFullCounterName(node, object, counter))
+			v, err := strconv.ParseFloat(valueText, 64)
+			return v, ok && err == nil
+		}
+
+		nodeValues := []string{}
+		for _, counter := range totalCounters {
+			if v, ok := value("Cisco CallManager", counter); ok {
+				sums[counter] += v
+				found[counter] = true
+				nodeValues = append(nodeValues, fmt.Sprintf("%s %s", counter, strconv.FormatFloat(v, 'f', -1, 64)))
+			}
+		}
+		for _, p := range protocols {
+			if v, ok := value(p.object, p.counterName); ok {
+				sums[p.protocol] += v
+				found[p.protocol] = true
+				nodeValues = append(nodeValues, fmt.Sprintf("%s %s", p.protocol, strconv.FormatFloat(v, 'f', -1, 64)))
+			}
+		}
+		if len(nodeValues) > 0 && len(nodes) > 1 {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s", node, strings.Join(nodeValues, ", ")))
+		} else if len(nodeValues) > 0 {
+			longOutput = append(longOutput, strings.Join(nodeValues, ", "))
+		}
+	}
+
+	total := sums[totalCounters[0]] + sums[totalCounters[1]]
+	warning, critical := givenThresholds()
+	returnVal := givenThresholdsReturnVal(total, warning, critical)
+	if returnVal != 0 {
+		problems = append(problems, fmt.Sprintf("total %s", returnValText(returnVal)))
+	}
+	combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+	for _, counter := range totalCounters {
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s;;;0;", strings.ToLower(strings.TrimPrefix(counter, "Registered")), strconv.FormatFloat(sums[counter], 'f', -1, 64)))
+	}
+
+	protocolText := []string{}
+	sort.SliceStable(protocols, func(i, j int) bool { return protocols[i].protocol < protocols[j].protocol })
+	for _, p := range protocols {
+		if !found[p.protocol] {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s counter %s\\%s not found", p.protocol, p.object, p.counterName))
+			continue
+		}
+		v := sums[p.protocol]
+		returnVal := 0
+		if p.warning != "" || p.critical != "" {
+			returnVal = getNagiosReturnVal(v, p.warning, p.critical)
+		}
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s %s %s", p.protocol, strconv.FormatFloat(v, 'f', -1, 64), returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		protocolText = append(protocolText, fmt.Sprintf("%s %s", p.protocol, strconv.FormatFloat(v, 'f', -1, 64)))
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;%s;0;", strings.ToLower(p.protocol), strconv.FormatFloat(v, 'f', -1, 64), p.warning, p.critical))
+	}
+
+	text := fmt.Sprintf("%s %s registered stations (%s)", outputPrefix, strconv.FormatFloat(total, 'f', -1, 64), strings.Join(protocolText, ", "))
+	if len(problems) > 0 {
+		text += ": " + strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          text,
+		label:         "registered",
+		value:         strconv.FormatFloat(total, 'f', -1, 64),
+		warning:       warning,
+		critical:      critical,
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode registrations
+func dryRunRegistrations(object string) (*dryRunPlan, error) {
+	protocols, err := parseProtocolCounters(protocolCounters, protocolThresholds)
+	if err != nil {
+		return nil, err
+	}
+	warning, critical := givenThresholds()
+	if warning != "" {
+		warning = "total " + warning
+	}
+	if critical != "" {
+		critical = "total " + critical
+	}
+	plan := &dryRunPlan{queries: []dryRunQuery{{"Cisco CallManager", "Cisco CallManager", "RegisteredHardwarePhones", warning, critical},
+		{"Cisco CallManager", "Cisco CallManager", "RegisteredOtherStationDevices", warning, critical}}}
+	for _, p := range protocols {
+		plan.queries = append(plan.queries, dryRunQuery{p.object, p.object, p.counterName, p.warning, p.critical})
+	}
+	return plan, nil
+}
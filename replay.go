@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// saved SOAP response of -replay used instead of a request to the server
+func replayResponse() ([]byte, error) {
+	body, err := ioutil.ReadFile(replayFile)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read replay file: %s", err)
+	}
+	debugPrintf(2, "replaying SOAP response from %s\n", replayFile)
+	return body, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// perfmon REST calls of -transport rest. the JSON responses are converted to
+// the SOAP envelope structs (their cache format) so parsing, thresholds and
+// output stay the same for both transports.
+
+type (
+	restCounter struct {
+		Name    string          `json:"name"`
+		Value   json.RawMessage `json:"value"`
+		CStatus json.RawMessage `json:"cstatus"`
+	}
+
+	restObject struct {
+		Name          string          `json:"name"`
+		MultiInstance json.RawMessage `json:"multiInstance"`
+		Counters      []restCounter   `json:"counters"`
+	}
+)
+
+// JSON number, boolean or string value as text
+func restText(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	return strings.TrimSpace(string(v))
+}
+
+// POST a JSON perfmon REST call and decode the response
+func restRequest(ipAddr, call string, request, response interface{}) (string, error) {
+	data, _ := json.Marshal(request)
+	resp, body, usedHost, err := soapRequest(ipAddr, strings.TrimRight(restPath, "/")+"/"+call, "", string(data))
+	if err != nil {
+		return "", fmt.Errorf("HTTPS request error: %s", err)
+	}
+	debugPrintf(3, "REST response: %s\n", body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("REST %s: %s", call, resp.Status)
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return "", fmt.Errorf("REST %s JSON error: %s", call, err)
+	}
+	return failoverText(ipAddr, usedHost), nil
+}
+
+// collectCounterData REST call, counters as list or in a counters field
+func restCollectCounterData(ipAddr, nodeIpAddr, object string) (*CounterEnvelope, string, error) {
+	var raw json.RawMessage
+	failoverText, err := restRequest(ipAddr, "collectCounterData", map[string]string{"host": nodeIpAddr, "object": object}, &raw)
+	if err != nil {
+		return nil, "", err
+	}
+	var wrapped struct {
+		Counters []restCounter `json:"counters"`
+	}
+	counters := []restCounter{}
+	if json.Unmarshal(raw, &counters) != nil {
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, "", fmt.Errorf("REST collectCounterData JSON error: %s", err)
+		}
+		counters = wrapped.Counters
+	}
+
+	items := []interface{}{}
+	for _, c := range counters {
+		items = append(items, map[string]interface{}{
+			"Name":    map[string]string{"Text": c.Name},
+			"Value":   map[string]string{"Text": restText(c.Value)},
+			"CStatus": map[string]string{"Text": restText(c.CStatus)},
+		})
+	}
+	converted, _ := json.Marshal(map[string]interface{}{"Body": map[string]interface{}{"PerfmonCollectCounterDataResponse": map[string]interface{}{"ArrayOfCounterInfo": map[string]interface{}{"ArrayOfCounterInfo": items}}}})
+	counterEnvelope := new(CounterEnvelope)
+	if err := json.Unmarshal(converted, counterEnvelope); err != nil {
+		return nil, "", err
+	}
+	return counterEnvelope, failoverText, nil
+}
+
+// listCounter REST call, objects as list or in an objects field
+func restListCounter(ipAddr, nodeIpAddr string) (*ListCounterEnvelope, error) {
+	var raw json.RawMessage
+	if _, err := restRequest(ipAddr, "listCounter", map[string]string{"host": nodeIpAddr}, &raw); err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Objects []restObject `json:"objects"`
+	}
+	objects := []restObject{}
+	if json.Unmarshal(raw, &objects) != nil {
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, fmt.Errorf("REST listCounter JSON error: %s", err)
+		}
+		objects = wrapped.Objects
+	}
+
+	items := []interface{}{}
+	for _, o := range objects {
+		counters := []interface{}{}
+		for _, c := range o.Counters {
+			counters = append(counters, map[string]interface{}{"Name": map[string]string{"Text": c.Name}})
+		}
+		items = append(items, map[string]interface{}{
+			"Name":           map[string]string{"Text": o.Name},
+			"MultiInstance":  map[string]string{"Text": restText(o.MultiInstance)},
+			"ArrayOfCounter": map[string]interface{}{"ArrayOfCounter": counters},
+		})
+	}
+	converted, _ := json.Marshal(map[string]interface{}{"Body": map[string]interface{}{"PerfmonListCounterResponse": map[string]interface{}{"ArrayOfObjectInfo": map[string]interface{}{"ArrayOfObjectInfo": items}}}})
+	listCounterEnvelope := new(ListCounterEnvelope)
+	if err := json.Unmarshal(converted, listCounterEnvelope); err != nil {
+		return nil, err
+	}
+	return listCounterEnvelope, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+const (
+	risPortPath   = "/realtimeservice2/services/RISService70"
+	risMaxDevices = 1000
+	risMaxBatches = 50
+)
+
+type (
+	RisDevice struct {
+		Name        string `xml:"Name"`
+		DirNumber   string `xml:"DirNumber"`
+		DeviceClass string `xml:"DeviceClass"`
+		Model       string `xml:"Model"`
+		Product     string `xml:"Product"`
+		Status      string `xml:"Status"`
+		Protocol    string `xml:"Protocol"`
+		IPAddress   string `xml:"IPAddress>item>IP"`
+		Node        string `xml:"-"`
+	}
+
+	SelectCmDeviceEnvelope struct {
+		XMLName xml.Name `xml:"Envelope"`
+		Body    struct {
+			SelectCmDeviceResponse struct {
+				SelectCmDeviceReturn struct {
+					SelectCmDeviceResult struct {
+						TotalDevicesFound int `xml:"TotalDevicesFound"`
+						CmNodes           struct {
+							Item []struct {
+								ReturnCode string `xml:"ReturnCode"`
+								Name       string `xml:"Name"`
+								CmDevices  struct {
+									Item []RisDevice `xml:"item"`
+								} `xml:"CmDevices"`
+							} `xml:"item"`
+						} `xml:"CmNodes"`
+					} `xml:"SelectCmDeviceResult"`
+					StateInfo string `xml:"StateInfo"`
+				} `xml:"selectCmDeviceReturn"`
+			} `xml:"selectCmDeviceResponse"`
+			Fault struct {
+				Faultstring string `xml:"faultstring"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+
+	// devices of a selectCmDevice query, cached like perfmon objects
+	RisDevices struct {
+		Devices []RisDevice
+	}
+)
+
+// selectCmDevice request of all devices of a device class in batches of risMaxDevices
+func selectCmDeviceXML(deviceClass, stateInfo string) string {
+	return soapEnvelope(fmt.Sprintf(`<soap:selectCmDevice><soap:StateInfo>%s</soap:StateInfo><soap:CmSelectionCriteria><soap:MaxReturnedDevices>%d</soap:MaxReturnedDevices><soap:DeviceClass>%s</soap:DeviceClass><soap:Model>255</soap:Model><soap:Status>Any</soap:Status><soap:NodeName></soap:NodeName><soap:SelectBy>Name</soap:SelectBy><soap:SelectItems><soap:item><soap:Item>*</soap:Item></soap:item></soap:SelectItems><soap:Protocol>Any</soap:Protocol><soap:DownloadStatus>Any</soap:DownloadStatus></soap:CmSelectionCriteria></soap:selectCmDevice>`,
+		html.EscapeString(stateInfo), risMaxDevices, deviceClass))
+}
+
+// query the RisPort70 real-time status of all devices of a device class (Phone,
+// Gateway, SIPTrunk, ...). a device reported by several nodes, e.g. after a
+// failover, is returned once with the registered entry preferred. the device
+// list is cached for the maximum cache age.
+func risDevices(ipAddr, deviceClass string) ([]RisDevice, error) {
+	cached := new(RisDevices)
+	if replayFile == "" && loadStruct(ipAddr, "RisPort "+deviceClass, objectCacheAge("RisPort "+deviceClass), cached) {
+		debugPrintf(3, "RisPort devices from cache: %d\n", len(cached.Devices))
+		return cached.Devices, nil
+	}
+
+	devices := map[string]RisDevice{}
+	names := []string{}
+	stateInfo := ""
+	for batch := 0; batch < risMaxBatches; batch++ {
+		request := selectCmDeviceXML(deviceClass, stateInfo)
+		debugPrintf(3, "RisPort SOAP request: %s\n", request)
+		resp, body, _, err := soapRequest(ipAddr, risPortPath, "selectCmDevice", request)
+		if err != nil {
+			return nil, fmt.Errorf("HTTPS request error: %s", err)
+		}
+		debugPrintf(3, "RisPort SOAP response: %s\n", body)
+
+		envelope := new(SelectCmDeviceEnvelope)
+		err = xml.Unmarshal(body, envelope)
+		if envelope.Body.Fault.Faultstring != "" {
+			return nil, fmt.Errorf("RisPort fault: %s", envelope.Body.Fault.Faultstring)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("RisPort HTTP status: %s", resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RisPort XML unmarshal error: %s", err)
+		}
+
+		result := envelope.Body.SelectCmDeviceResponse.SelectCmDeviceReturn
+		found := 0
+		for _, node := range result.SelectCmDeviceResult.CmNodes.Item {
+			for _, device := range node.CmDevices.Item {
+				found++
+				device.Node = node.Name
+				previous, seen := devices[device.Name]
+				if !seen {
+					names = append(names, device.Name)
+				}
+				if !seen || (previous.Status != "Registered" && device.Status == "Registered") {
+					devices[device.Name] = device
+				}
+			}
+		}
+		// RisPort returns a StateInfo to continue with the next batch
+		if found < risMaxDevices || result.StateInfo == "" || result.StateInfo == stateInfo {
+			break
+		}
+		stateInfo = result.StateInfo
+	}
+
+	for _, name := range names {
+		cached.Devices = append(cached.Devices, devices[name])
+	}
+	if replayFile == "" {
+		saveStruct(ipAddr, "RisPort "+deviceClass, cached)
+	}
+	return cached.Devices, nil
+}
+
+// true if the RisPort status is registered
+func risRegistered(device RisDevice) bool {
+	return strings.EqualFold(device.Status, "Registered")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// per minute rate of an increasing counter since the previous run, the last
+// value and time are kept in the state data under key. false on the first
+// run and after a counter reset.
+func counterRate(state *CheckState, key string, value float64, now time.Time) (float64, bool) {
+	previous := strings.Fields(state.Data[key])
+	state.Data[key] = fmt.Sprintf("%s %d", strconv.FormatFloat(value, 'f', -1, 64), now.Unix())
+	if len(previous) != 2 {
+		return 0, false
+	}
+	last, err1 := strconv.ParseFloat(previous[0], 64)
+	lastTime, err2 := strconv.ParseInt(previous[1], 10, 64)
+	elapsed := now.Sub(time.Unix(lastTime, 0)).Minutes()
+	if err1 != nil || err2 != nil || value < last || elapsed <= 0 {
+		return 0, false
+	}
+	return (value - last) / elapsed, true
+}
+
+// check the route list exhaustion of all route list instances: -w and -c are
+// RouteListExhausted events per minute since the previous run. a route list
+// using all in service channels is at least WARNING.
+func checkRouteLists(nodes []string) *checkResult {
+	object := "Cisco Route Lists"
+	if flagGiven("o") {
+		object = perfmonObject(objectInstance)
+	}
+
+	state := currentCheckState()
+	if state == nil {
+		return &checkResult{returnVal: 3, text: "route list check needs the state file, see -state-dir"}
+	}
+
+	now := time.Now()
+	combinedReturnVal := 0
+	checked := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		// always fetched, the rate needs the current value
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			continue
+		}
+
+		exhausted := counterInstances(counterEnvelope, node, object, "RouteListExhausted")
+		sort.Slice(exhausted, func(i, j int) bool { return exhausted[i].instance < exhausted[j].instance })
+		active := map[string]float64{}
+		for _, v := range counterInstances(counterEnvelope, node, object, "CallsActive") {
+			active[v.instance] = v.value
+		}
+		inService := map[string]float64{}
+		for _, v := range counterInstances(counterEnvelope, node, object, "ChannelsInService") {
+			inService[v.instance] = v.value
+		}
+
+		for _, v := range exhausted {
+			checked++
+			label := labelPrefix + v.instance
+			returnVal := 0
+			rateText := "n/a, first run"
+			if rate, ok := counterRate(state, "route list "+node+" "+v.instance, v.value, now); ok {
+				rateText = strconv.FormatFloat(rate, 'f', 2, 64) + "/min"
+				returnVal = getNagiosReturnVal(rate, warningThreshold, criticalThreshold)
+				perfdata = append(perfdata, fmt.Sprintf("%s_exhausted_per_min=%s;%s;%s;0;", label, strconv.FormatFloat(rate, 'f', 2, 64), warningThreshold, criticalThreshold))
+			}
+			line := fmt.Sprintf("%s: RouteListExhausted %s (total %s)", label, rateText, v.text)
+			if channels, ok := inService[v.instance]; ok && channels > 0 {
+				usage := active[v.instance] / channels * 100
+				line += fmt.Sprintf(", %.0f of %.0f channels active", active[v.instance], channels)
+				perfdata = append(perfdata, fmt.Sprintf("%s_channels_used=%.1f;100;;0;100", label, usage))
+				if usage >= 100 && returnVal == 0 {
+					returnVal = 1
+				}
+			}
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s %s", label, returnValText(returnVal)))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			longOutput = append(longOutput, fmt.Sprintf("%s %s", line, returnValText(returnVal)))
+		}
+	}
+
+	summary := "no exhaustion"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d route lists: %s", outputPrefix, object, checked, summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode route-list
+func dryRunRouteLists(object string) (*dryRunPlan, error) {
+	instance := objectInstance
+	if !flagGiven("o") {
+		object, instance = "Cisco Route Lists", "Cisco Route Lists(*)"
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, instance, "RouteListExhausted", warningThreshold + " per minute", criticalThreshold + " per minute"}}}, nil
+}
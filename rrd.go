@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var rrdNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// RRD file of a metric: <node>_<instance>_<counter>.rrd with unsafe characters replaced
+func rrdFileName(m metric) string {
+	parts := []string{m.Node}
+	if m.Instance != "" {
+		parts = append(parts, m.Instance)
+	}
+	parts = append(parts, strings.Replace(m.Counter, "%", "Percent", -1))
+	name := strings.Trim(rrdNameRe.ReplaceAllString(strings.Join(parts, "_"), "_"), "_")
+	return filepath.Join(rrdDir, name+".rrd")
+}
+
+// rrdtool create arguments: one GAUGE data source, averages of 1 step for 7
+// days, 30 minutes for 31 days, 2 hours for 4 months and 1 day for 5 years
+// with MAX archives of the same resolution
+func rrdCreateArgs(filename string) []string {
+	step := rrdStep
+	heartbeat := strconv.Itoa(step * 2)
+	args := []string{"create", filename, "--step", strconv.Itoa(step), "DS:value:GAUGE:" + heartbeat + ":U:U"}
+	for _, rra := range [][2]int{{1, 7 * 86400}, {1800, 31 * 86400}, {7200, 122 * 86400}, {86400, 5 * 366 * 86400}} {
+		steps := rra[0] / step
+		if steps < 1 {
+			steps = 1
+		}
+		rows := rra[1] / (steps * step)
+		for _, cf := range []string{"AVERAGE", "MAX"} {
+			args = append(args, fmt.Sprintf("RRA:%s:0.5:%d:%d", cf, steps, rows))
+		}
+	}
+	return args
+}
+
+// update the RRD file of every metric with rrdtool, missing files are created
+func updateRRDs(metrics []metric) error {
+	if err := os.MkdirAll(rrdDir, 0755); err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		filename := rrdFileName(m)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			if out, err := exec.Command(rrdtoolPath, rrdCreateArgs(filename)...).CombinedOutput(); err != nil {
+				return fmt.Errorf("rrdtool create %s: %s %s", filename, err, strings.TrimSpace(string(out)))
+			}
+			debugPrintf(3, "RRD file created: %s\n", filename)
+		}
+		update := fmt.Sprintf("%d:%s", m.Time, strconv.FormatFloat(m.Value, 'f', -1, 64))
+		if out, err := exec.Command(rrdtoolPath, "update", filename, update).CombinedOutput(); err != nil {
+			return fmt.Errorf("rrdtool update %s: %s %s", filename, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// preconfigured RTMT alert evaluated as named check
+type rtmtAlert struct {
+	name           string
+	object         string
+	objectInstance string
+	counterName    string
+	available      bool   // evaluate 100 - value, the RTMT thresholds are on the available percentage
+	threshold      string // alert range
+	returnVal      int    // plugin return code of the raised alert
+}
+
+// RTMT default alert thresholds
+var rtmtAlerts = []rtmtAlert{
+	{"CpuPegging", "Processor", "Processor(_Total)", "% CPU Time", false, "90", 2},
+	{"LowActivePartitionAvailableDiskSpace", "Partition", "Partition(Active)", "% Used", true, "4:", 2},
+	{"LowInactivePartitionAvailableDiskSpace", "Partition", "Partition(Inactive)", "% Used", true, "4:", 1},
+	{"LowAvailableDiskSpace", "Partition", "Partition(Common)", "% Used", true, "10:", 2},
+	{"LowSwapPartitionAvailableDiskSpace", "Partition", "Partition(Swap)", "% Used", true, "10:", 2},
+	{"LowAvailableVirtualMemory", "Memory", "Memory", "% VM Used", true, "30:", 1},
+	{"DBReplicationFailure", "Number of Replicates Created and State of Replication", "Number of Replicates Created and State of Replication(ReplicateCount)", "Replicate_State", false, "2:2", 2},
+}
+
+// parse the comma separated -rtmt list of alert names with optional =range
+// overrides. all selects every alert.
+func parseRTMTAlerts(list string) ([]rtmtAlert, error) {
+	alerts := []rtmtAlert{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, threshold := entry, ""
+		if pos := strings.Index(entry, "="); pos != -1 {
+			name, threshold = entry[:pos], entry[pos+1:]
+		}
+		found := false
+		for _, alert := range rtmtAlerts {
+			if strings.EqualFold(name, "all") || strings.EqualFold(name, alert.name) {
+				if threshold != "" {
+					alert.threshold = threshold
+				}
+				alerts = append(alerts, alert)
+				found = true
+			}
+		}
+		if !found {
+			names := []string{}
+			for _, alert := range rtmtAlerts {
+				names = append(names, alert.name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown RTMT alert: %s, known alerts: %s", name, strings.Join(names, ", "))
+		}
+	}
+	return alerts, nil
+}
+
+// evaluate the -rtmt alerts on every node like RTMT would raise them
+func checkRTMT(nodes []string) *checkResult {
+	alerts, err := parseRTMTAlerts(rtmtAlertList)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	combinedReturnVal := 0
+	raised := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		envelopes := map[string]*CounterEnvelope{}
+
+		for _, alert := range alerts {
+			counterEnvelope, ok := envelopes[alert.object]
+			if !ok {
+				counterEnvelope, _, err = collectCounterData(ipAddr, node, alert.object)
+				if err != nil {
+					combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+					raised = append(raised, fmt.Sprintf("%s %s", node, err))
+					longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+					break
+				}
+				envelopes[alert.object] = counterEnvelope
+			}
+
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, alert.objectInstance, alert.counterName))
+			value, err := strconv.ParseFloat(valueText, 64)
+			if !found || err != nil {
+				longOutput = append(longOutput, fmt.Sprintf("%s: %s %s\\%s n/a", node, alert.name, alert.objectInstance, alert.counterName))
+				continue
+			}
+			valueName := alert.counterName
+			if alert.available {
+				value = 100 - value
+				valueName = "available"
+				valueText = strconv.FormatFloat(value, 'f', 1, 64)
+			}
+
+			returnVal := 0
+			if generateAlert(value, alert.threshold) {
+				returnVal = alert.returnVal
+				raised = append(raised, fmt.Sprintf("%s %s (%s=%s)", node, alert.name, valueName, valueText))
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+
+			warning, critical := alert.threshold, alert.threshold
+			if alert.returnVal == 1 {
+				critical = ""
+			}
+			perfdata = append(perfdata, fmt.Sprintf("%s/%s=%s;%s;%s;;", node, alert.name, valueText, warning, critical))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s %s=%s %s (threshold %s)", node, alert.name, valueName, valueText, returnValText(returnVal), alert.threshold))
+		}
+	}
+
+	summary := "no alerts raised"
+	if len(raised) > 0 {
+		summary = strings.Join(raised, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s RTMT %d alerts: %s", outputPrefix, len(alerts), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -rtmt
+func dryRunRTMT(object string) (*dryRunPlan, error) {
+	alerts, err := parseRTMTAlerts(rtmtAlertList)
+	if err != nil {
+		return nil, err
+	}
+	plan := &dryRunPlan{}
+	for _, alert := range alerts {
+		q := dryRunQuery{alert.object, alert.objectInstance, alert.counterName, "", alert.threshold}
+		if alert.returnVal == 1 {
+			q.warning, q.critical = alert.threshold, ""
+		}
+		plan.queries = append(plan.queries, q)
+	}
+	return plan, nil
+}
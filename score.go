@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default weights of the -mode score components, see -score-weights
+const defaultScoreWeights = "cpu=3,memory=2,disk_active=2,disk_common=1,replication=2"
+
+// counter contributing to the health score
+type scoreComponent struct {
+	name           string
+	object         string
+	objectInstance string
+	counterName    string
+	weight         float64
+	critical       string // non percent counters: full penalty if the value is outside this range
+}
+
+// parse the comma separated name=weight list of -score-weights. names are the
+// -mode health indicators or object(instance)\counter of a percent counter.
+func parseScoreWeights(spec string) ([]scoreComponent, error) {
+	components := []scoreComponent{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pos := strings.LastIndex(entry, "=")
+		if pos == -1 {
+			return nil, fmt.Errorf("invalid score weight: %s, use name=weight", entry)
+		}
+		name := entry[:pos]
+		weight, err := strconv.ParseFloat(entry[pos+1:], 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid score weight: %s, use name=weight", entry)
+		}
+
+		c := scoreComponent{name: name, weight: weight}
+		found := false
+		for _, indicator := range healthIndicators {
+			if indicator.name == name {
+				c.object, c.objectInstance, c.counterName = indicator.object, indicator.objectInstance, indicator.counterName
+				if !strings.HasPrefix(indicator.counterName, "%") {
+					c.critical = indicator.critical
+				}
+				found = true
+			}
+		}
+		if !found {
+			pos := strings.LastIndex(name, "\\")
+			if pos == -1 {
+				return nil, fmt.Errorf("unknown score component: %s", name)
+			}
+			c.objectInstance, c.counterName = name[:pos], name[pos+1:]
+			c.object = perfmonObject(c.objectInstance)
+		}
+		components = append(components, c)
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("no score components given")
+	}
+	return components, nil
+}
+
+// penalty of a component value from 0 (good) to 1 (bad)
+func scorePenalty(c scoreComponent, value float64) float64 {
+	if c.critical != "" {
+		if generateAlert(value, c.critical) {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case value < 0:
+		return 0
+	case value > 100:
+		return 1
+	}
+	return value / 100
+}
+
+// weighted 0-100 health score per node. the thresholds apply to the score,
+// e.g. -w 70: -c 50:. the long output lists the biggest contributors.
+func checkScore(nodes []string) *checkResult {
+	components, err := parseScoreWeights(scoreWeights)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	type contribution struct {
+		text   string
+		points float64
+	}
+
+	combinedReturnVal := 0
+	scores := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		envelopes := map[string]*CounterEnvelope{}
+		contributions := []contribution{}
+		missing := []string{}
+		totalWeight, totalPenalty := 0.0, 0.0
+		var nodeErr error
+
+		for _, c := range components {
+			counterEnvelope, ok := envelopes[c.object]
+			if !ok {
+				counterEnvelope, _, nodeErr = collectCounterData(ipAddr, node, c.object)
+				if nodeErr != nil {
+					break
+				}
+				envelopes[c.object] = counterEnvelope
+			}
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, c.objectInstance, c.counterName))
+			value, err := strconv.ParseFloat(valueText, 64)
+			if !found || err != nil {
+				missing = append(missing, fmt.Sprintf("%s: %s n/a, not part of the score", node, c.name))
+				continue
+			}
+			penalty := scorePenalty(c, value) * c.weight
+			totalWeight += c.weight
+			totalPenalty += penalty
+			contributions = append(contributions, contribution{fmt.Sprintf("%s=%s (weight %g)", c.name, valueText, c.weight), penalty})
+		}
+
+		if nodeErr != nil || totalWeight == 0 {
+			text := "no score component available"
+			if nodeErr != nil {
+				text = nodeErr.Error()
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			scores = append(scores, fmt.Sprintf("%s %s", node, returnValText(3)))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), text))
+			continue
+		}
+
+		score := 100 - totalPenalty/totalWeight*100
+		scoreText := fmt.Sprintf("%.1f", score)
+		returnVal := getNagiosReturnVal(score, warningThreshold, criticalThreshold)
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		scores = append(scores, fmt.Sprintf("%s score=%s %s", node, scoreText, returnValText(returnVal)))
+		perfdata = append(perfdata, fmt.Sprintf("%s/score=%s;%s;%s;0;100", node, scoreText, warningThreshold, criticalThreshold))
+
+		sort.SliceStable(contributions, func(i, j int) bool { return contributions[i].points > contributions[j].points })
+		for _, c := range contributions {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s -%.1f points", node, c.text, c.points/totalWeight*100))
+		}
+		longOutput = append(longOutput, missing...)
+	}
+
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s health score: %s", outputPrefix, strings.Join(scores, ", ")),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode score
+func dryRunScore(object string) (*dryRunPlan, error) {
+	components, err := parseScoreWeights(scoreWeights)
+	if err != nil {
+		return nil, err
+	}
+	plan := &dryRunPlan{summary: []string{fmt.Sprintf("score warning: %s critical: %s", warningThreshold, criticalThreshold)}}
+	for _, c := range components {
+		plan.queries = append(plan.queries, dryRunQuery{c.object, c.objectInstance, c.counterName, "", c.critical})
+	}
+	return plan, nil
+}
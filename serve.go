@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// check request of the -serve JSON API. the fields are shortcuts for the
+// common flags, args are any further plugin arguments.
+type serveRequest struct {
+	Host     string   `json:"host"`
+	Node     string   `json:"node,omitempty"`
+	Object   string   `json:"object,omitempty"`
+	Counter  string   `json:"counter,omitempty"`
+	Warning  string   `json:"warning,omitempty"`
+	Critical string   `json:"critical,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+	Args     []string `json:"args,omitempty"`
+}
+
+// check result returned by the -serve JSON API
+type serveResponse struct {
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"`
+}
+
+// flags accepted in the args of a check request: the counter, mode and
+// threshold flags of a check. everything else, credentials, paths, outputs
+// and servers, is taken from the server command line. -M and -N only select
+// the perfmon hosts queried via the -H publisher.
+var serveCheckFlags = []string{"N", "M", "o", "n", "i", "instance", "w", "c", "mode", "health", "rtmt", "product", "convert", "invalid-value-as", "invalid-values",
+	"precision", "time-thresholds", "node-thresholds", "node-aggregate", "expect", "expect-one-of", "value-map", "cmr-interval", "quality-thresholds", "stuck-runs",
+	"heartbeat-stall", "protocol-counters", "protocol-thresholds", "pilot-thresholds", "hunt-wait", "hunt-abandoned", "presence-thresholds", "sso-path",
+	"ils-counters", "ils-thresholds", "tftp-not-found", "capacity-counter", "describe", "unknown-as-ok", "critical-cap", "all-perfdata", "all-perfdata-filter",
+	"top", "sort", "limit", "include-instance", "exclude-instance", "warmup", "uptime-counter", "score-weights", "samples", "self-perfdata", "trend-window",
+	"trend-warning", "trend-critical", "warn-cert-days", "ignore-case", "output-format", "perfdata-only", "all-nodes", "show-correlation-id"}
+
+// flags of the server command line not passed to the checks of the server
+var serverOnlyFlags = []string{"clusters", "clusters-file"}
+
+// name of a command line flag argument like -name, --name or -name=value
+func argFlagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	return strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+}
+
+// split plugin arguments into the flags with their values, e.g.
+// [[-n, % CPU Time] [-health] [-w=80]]. values starting with - like -w -5
+// are taken as value of the preceding flag.
+func splitFlagArgs(args []string) ([][]string, error) {
+	split := [][]string{}
+	for i := 0; i < len(args); i++ {
+		name := argFlagName(args[i])
+		if name == "" {
+			return nil, fmt.Errorf("unexpected argument %s", args[i])
+		}
+		f := flag.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown flag %s", args[i])
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); strings.Contains(args[i], "=") || ok && b.IsBoolFlag() {
+			split = append(split, args[i:i+1])
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, fmt.Errorf("flag %s needs a value", args[i])
+		}
+		split = append(split, args[i:i+2])
+		i++
+	}
+	return split, nil
+}
+
+// true if the flag name is one of the serverOnlyFlags
+func serverOnly(name string) bool {
+	for _, f := range serverOnlyFlags {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// true if the flag of arg is accepted in check requests
+func serveCheckFlag(arg string) bool {
+	name := argFlagName(arg)
+	for _, f := range serveCheckFlags {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// CUCM hosts check requests may query, the server's -H, -serve-hosts and the
+// -clusters and -clusters-file hosts. the checks send the credentials of the
+// server to these hosts.
+func serveAllowedHosts() (map[string]bool, error) {
+	hosts := map[string]bool{}
+	for _, host := range apiHosts(ipAddr + "," + serveHosts) {
+		hosts[host] = true
+	}
+	clusters, err := getClusters()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		for _, host := range apiHosts(c.host) {
+			hosts[host] = true
+		}
+	}
+	delete(hosts, "")
+	return hosts, nil
+}
+
+// plugin arguments of a check request, the host has to be one of the
+// allowed hosts and args may only contain the -serve check flags
+func (req *serveRequest) arguments(allowedHosts map[string]bool) ([]string, error) {
+	if req.Host == "" {
+		return nil, fmt.Errorf("host missing")
+	}
+	for _, host := range apiHosts(req.Host) {
+		if !allowedHosts[host] {
+			return nil, fmt.Errorf("host %s is not served, see -serve-hosts", host)
+		}
+	}
+	args := []string{"-H", req.Host}
+	for _, a := range []struct{ flag, value string }{{"-N", req.Node}, {"-o", req.Object}, {"-n", req.Counter}, {"-w", req.Warning}, {"-c", req.Critical}, {"-mode", req.Mode}} {
+		if a.value != "" {
+			args = append(args, a.flag, a.value)
+		}
+	}
+	split, err := splitFlagArgs(req.Args)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range split {
+		// @filename values like -M @nodes or -node-thresholds @file would read
+		// files of the server, for -w and -c @ is the inside range
+		value := f[len(f)-1]
+		if len(f) == 1 {
+			value = f[0][strings.Index(f[0], "=")+1:]
+		}
+		name := argFlagName(f[0])
+		if !serveCheckFlag(f[0]) {
+			return nil, fmt.Errorf("flag %s is not allowed in a check request", f[0])
+		}
+		if strings.HasPrefix(value, "@") && name != "w" && name != "c" {
+			return nil, fmt.Errorf("@filename value of %s is not allowed in a check request", f[0])
+		}
+		args = append(args, f...)
+	}
+	return args, nil
+}
+
+// server flags passed to every check: the server command line without the
+// -serve and cluster list flags, so credentials, cache, session and state
+// files are shared
+func serverArguments() []string {
+	args := []string{}
+	skip := false
+	serverArgs := os.Args[1:]
+	if len(serverArgs) > 0 && subcommandOf(serverArgs[0]) != nil {
+		serverArgs = serverArgs[1:]
+	}
+	for _, arg := range serverArgs {
+		if skip {
+			skip = false
+			continue
+		}
+		name := argFlagName(arg)
+		if strings.HasPrefix(name, "serve") || serverOnly(name) {
+			// -serve-max 4 or -serve-max=4
+			skip = !strings.Contains(arg, "=")
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// run a check as child process of the plugin binary. every check gets its own
+// process as the checks keep their state in package variables, the file
+// cache and the Tomcat session cookies of the cache directory are shared.
+// id is passed as -correlation-id to find the log lines of the check.
+func runServeCheck(ctx context.Context, id string, args []string) *serveResponse {
+	executable, err := os.Executable()
+	if err != nil {
+		return &serveResponse{Status: returnValText(3), ExitCode: 3, Output: fmt.Sprintf("%s - %s", returnValText(3), err)}
+	}
+	ctx, cancel := context.WithTimeout(ctx, serveTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, executable, append(append(serverArguments(), "-correlation-id="+id), args...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+
+	exitCode := 0
+	if ctx.Err() == context.DeadlineExceeded {
+		return &serveResponse{Status: returnValText(3), ExitCode: 3, Output: fmt.Sprintf("%s - check timed out after %s", returnValText(3), serveTimeout)}
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return &serveResponse{Status: returnValText(3), ExitCode: 3, Output: fmt.Sprintf("%s - %s", returnValText(3), err)}
+	}
+	if exitCode < 0 || exitCode > 3 {
+		exitCode = 3
+	}
+	return &serveResponse{Status: returnValText(exitCode), ExitCode: exitCode, Output: strings.TrimRight(stdout.String(), "\n")}
+}
+
+// self signed server certificate if -serve-cert is not given
+func serveSelfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "check_cisco_uc_perf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost", hostname},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// state of the -serve check server shared by the concurrent request
+// handlers, the state of a check is in its own child process
+type checkServer struct {
+	token        string
+	allowedHosts map[string]bool
+	slots        chan struct{} // at most -serve-max checks run at the same time
+	runCheck     func(ctx context.Context, id string, args []string) *serveResponse
+}
+
+func newCheckServer(allowedHosts map[string]bool) *checkServer {
+	max := serveMax
+	if max < 1 {
+		max = 1
+	}
+	return &checkServer{token: serveToken, allowedHosts: allowedHosts, slots: make(chan struct{}, max), runCheck: runServeCheck}
+}
+
+// POST /check with a serveRequest JSON body returns a serveResponse
+func (s *checkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req := new(serveRequest)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	args, err := req.arguments(s.allowedHosts)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	id := newCorrelationID()
+	resp := s.runCheck(r.Context(), id, args)
+	<-s.slots
+
+	debugPrintf(3, "serve %s %s: %s\n", id, strings.Join(args, " "), strings.SplitN(resp.Output, "\n", 2)[0])
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serve checks over HTTPS with a checkServer on /check
+func serve() int {
+	if serveToken == "" {
+		fmt.Printf("%s - -serve needs -serve-token, the checks run with the credentials of the server\n", returnValText(3))
+		return 3
+	}
+	allowedHosts, err := serveAllowedHosts()
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	if len(allowedHosts) == 0 {
+		fmt.Printf("%s - -serve needs the CUCM hosts of the check requests, use -serve-hosts, -clusters-file or -H\n", returnValText(3))
+		return 3
+	}
+
+	var cert tls.Certificate
+	if serveCert != "" {
+		cert, err = tls.LoadX509KeyPair(serveCert, serveKey)
+	} else {
+		cert, err = serveSelfSignedCert()
+	}
+	if err != nil {
+		fmt.Printf("%s - server certificate: %s\n", returnValText(3), err)
+		return 3
+	}
+	debugPrintf(1, "server certificate SHA-256 for -server-pin: %x\n", sha256.Sum256(cert.Certificate[0]))
+	mux := http.NewServeMux()
+	mux.Handle("/check", newCheckServer(allowedHosts))
+
+	server := &http.Server{
+		Addr:      serveAddr,
+		Handler:   mux,
+		TLSConfig: fipsTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}),
+	}
+	debugPrintf(1, "serving checks on https://%s/check\n", serveAddr)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	return 0
+}
+
+// TLS config of -server verifying the server with -server-ca or the
+// -server-pin SHA-256 fingerprint of its certificate, the token is only sent
+// to a verified server
+func serverTLSConfig() (*tls.Config, error) {
+	switch {
+	case serverCA != "":
+		pem, err := ioutil.ReadFile(serverCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", serverCA)
+		}
+		return fipsTLSConfig(&tls.Config{RootCAs: pool}), nil
+	case serverPin != "":
+		pin, err := hex.DecodeString(strings.ReplaceAll(serverPin, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid -server-pin %s, use the SHA-256 fingerprint logged by -serve", serverPin)
+		}
+		// the server certificate is usually self signed, the pin replaces the chain verification
+		return &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS12,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) > 0 {
+					if sum := sha256.Sum256(rawCerts[0]); subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+						return nil
+					}
+				}
+				return fmt.Errorf("server certificate doesn't match -server-pin")
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("-server needs -server-ca or -server-pin to verify the server")
+}
+
+// run the check on the -server instead of locally, the -serve check flags of
+// the plugin arguments are sent as request args and the result is printed as
+// if the check ran locally. the server uses its own credentials and paths.
+func runOnServer() int {
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	args := os.Args[1:]
+	if len(args) > 0 && subcommandOf(args[0]) != nil {
+		args = args[1:]
+	}
+	split, err := splitFlagArgs(args)
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	req := &serveRequest{Host: ipAddr}
+	for _, f := range split {
+		if serveCheckFlag(f[0]) {
+			req.Args = append(req.Args, f...)
+		}
+	}
+
+	body, _ := json.Marshal(req)
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimRight(serverURL, "/")+"/check", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if serveToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+serveToken)
+	}
+	client := &http.Client{
+		Timeout:   serveTimeout + 10*time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		fmt.Printf("%s - server %s: %s\n", returnValText(3), serverURL, err)
+		return 3
+	}
+	defer httpResp.Body.Close()
+	respBody, _ := ioutil.ReadAll(httpResp.Body)
+	if httpResp.StatusCode != http.StatusOK {
+		fmt.Printf("%s - server %s: %s %s\n", returnValText(3), serverURL, httpResp.Status, strings.TrimSpace(string(respBody)))
+		return 3
+	}
+	resp := new(serveResponse)
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		fmt.Printf("%s - server %s: %s\n", returnValText(3), serverURL, err)
+		return 3
+	}
+	fmt.Println(resp.Output)
+	return resp.ExitCode
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// check server with a fake check counting the concurrently running checks
+func testCheckServer(max int, running, peak *int32) *checkServer {
+	return &checkServer{
+		token:        "secret",
+		allowedHosts: map[string]bool{"cucm": true},
+		slots:        make(chan struct{}, max),
+		runCheck: func(ctx context.Context, id string, args []string) *serveResponse {
+			n := atomic.AddInt32(running, 1)
+			for {
+				p := atomic.LoadInt32(peak)
+				if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+					break
+				}
+			}
+			defer atomic.AddInt32(running, -1)
+			debugPrintf(3, "check %s %s\n", id, strings.Join(args, " "))
+			time.Sleep(5 * time.Millisecond)
+			return &serveResponse{Status: "OK", ExitCode: 0, Output: "OK - " + strings.Join(args, " ")}
+		},
+	}
+}
+
+func postCheck(t *testing.T, url, token string, req serveRequest) (*http.Response, *serveResponse) {
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Error(err)
+		return nil, nil
+	}
+	defer httpResp.Body.Close()
+	resp := new(serveResponse)
+	if httpResp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+			t.Error(err)
+		}
+	}
+	return httpResp, resp
+}
+
+// run with go test -race, the handlers share the server, the log writer and the secrets
+func TestCheckServerConcurrent(t *testing.T) {
+	var running, peak int32
+	server := httptest.NewServer(testCheckServer(3, &running, &peak))
+	defer server.Close()
+	debug = 3
+	log.SetOutput(redactWriter{ioutil.Discard})
+	defer func() {
+		debug = 0
+		log.SetOutput(os.Stderr)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addSecret("user", fmt.Sprintf("password%d", i))
+			counter := fmt.Sprintf("counter%d", i)
+			httpResp, resp := postCheck(t, server.URL, "secret", serveRequest{Host: "cucm", Object: "Memory", Counter: counter})
+			if httpResp == nil {
+				return
+			}
+			if httpResp.StatusCode != http.StatusOK || !strings.Contains(resp.Output, counter) {
+				t.Errorf("request %d: %s %v", i, httpResp.Status, resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Errorf("%d checks ran at the same time, -serve-max is 3", peak)
+	}
+}
+
+func TestCheckServerRejects(t *testing.T) {
+	var running, peak int32
+	server := httptest.NewServer(testCheckServer(1, &running, &peak))
+	defer server.Close()
+
+	for _, test := range []struct {
+		token string
+		req   serveRequest
+		want  int
+	}{
+		{"wrong", serveRequest{Host: "cucm"}, http.StatusUnauthorized},
+		{"secret", serveRequest{Host: "other"}, http.StatusBadRequest},
+		{"secret", serveRequest{Host: "cucm", Args: []string{"-u", "admin"}}, http.StatusBadRequest},
+		{"secret", serveRequest{Host: "cucm", Args: []string{"-M", "@/etc/passwd"}}, http.StatusBadRequest},
+	} {
+		if httpResp, _ := postCheck(t, server.URL, test.token, test.req); httpResp != nil && httpResp.StatusCode != test.want {
+			t.Errorf("%v: %s, want %d", test.req, httpResp.Status, test.want)
+		}
+	}
+	if peak != 0 {
+		t.Error("rejected request ran a check")
+	}
+}
+
+func TestCorrelationConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer correlateNode(fmt.Sprintf("node%d", i))()
+			defer correlateRequest()()
+			if !strings.HasPrefix(correlationPrefix(), "["+correlationID) || requestCorrelationID() == "" {
+				t.Error("invalid correlation prefix")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if correlation.node != "" || correlation.request != 0 {
+		t.Errorf("correlation not restored: %+v", correlation)
+	}
+}
+
+func TestRedactConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secret := fmt.Sprintf("redact-secret-%d", i)
+			addSecret("user", secret)
+			if s := redact("password is " + secret); strings.Contains(s, secret) {
+				t.Errorf("secret not masked: %s", s)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
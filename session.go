@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Tomcat session cookies (JSESSIONID, JSESSIONIDSSO) of a host reused instead of basic auth
+type sessionCookies struct {
+	Cookies map[string]string
+	Expiry  int64
+}
+
+// session cache file of a host and the -u user, readable by the owner only.
+// the user is part of the key so that checks with other credentials never
+// borrow a session of another account.
+func sessionFileName(host string) string {
+	id := fmt.Sprintf("%x", md5.Sum([]byte(host+"\x00"+username)))
+	return cacheFileName(id, "session")
+}
+
+// valid session cookies of a host, nil if there is no unexpired session
+func loadSession(host string) []*http.Cookie {
+	data, err := ioutil.ReadFile(sessionFileName(host))
+	if err != nil {
+		return nil
+	}
+	session := new(sessionCookies)
+	if json.Unmarshal(data, session) != nil || session.Expiry <= time.Now().Unix() || len(session.Cookies) == 0 {
+		return nil
+	}
+	cookies := []*http.Cookie{}
+	for name, value := range session.Cookies {
+		addSecret("", value)
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// save the session cookies set by a response. the session expires with the
+// first expiring cookie or after -session-ttl.
+func saveSession(host string, resp *http.Response) {
+	session := &sessionCookies{Cookies: map[string]string{}, Expiry: time.Now().Add(sessionTTL).Unix()}
+	for _, c := range resp.Cookies() {
+		if c.Name != "JSESSIONID" && c.Name != "JSESSIONIDSSO" {
+			continue
+		}
+		session.Cookies[c.Name] = c.Value
+		addSecret("", c.Value)
+		if c.MaxAge > 0 && time.Now().Unix()+int64(c.MaxAge) < session.Expiry {
+			session.Expiry = time.Now().Unix() + int64(c.MaxAge)
+		}
+		if !c.Expires.IsZero() && c.Expires.Unix() < session.Expiry {
+			session.Expiry = c.Expires.Unix()
+		}
+	}
+	if len(session.Cookies) == 0 {
+		return
+	}
+
+	filename := sessionFileName(host)
+	data, _ := json.Marshal(session)
+	if err := writeFileAtomic(filename, data, 0600); err != nil {
+		debugPrintf(1, "session cache error: %s\n", err)
+		return
+	}
+	debugPrintf(3, "session cookies of %s saved, expire %s\n", host, time.Unix(session.Expiry, 0))
+}
+
+// remove the session of a host after the server rejected it
+func dropSession(host string) {
+	os.Remove(sessionFileName(host))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default days until the Smart Licensing authorization expires
+const (
+	licenseExpiryWarning  = "30:"
+	licenseExpiryCritical = "7:"
+)
+
+// names of the getSmartLicenseStatus response elements, lower case, nested
+// elements as parent/child. the names differ between the AXL releases, the
+// first one found is used.
+var (
+	licenseRegistrationElements  = []string{"registrationstatus/status", "registrationstatus", "registrationstate"}
+	licenseAuthorizationElements = []string{"authorizationstatus/status", "licenseauthorizationstatus/status", "authorizationstatus", "licenseauthorizationstatus", "authorizationstate"}
+	licenseExpiryElements        = []string{"authorizationstatus/expires", "licenseauthorizationstatus/expires", "authorizationexpires", "authorizationexpiry", "authorizationexpirydate", "authorizationstatus/communicationdeadline", "communicationdeadline"}
+	licenseEvaluationElements    = []string{"evaluationperiodremaining", "evaluationdaysremaining", "evaldaysremaining", "remainingevaluationdays"}
+	licenseModeElements          = []string{"licensemode", "licensingmode"}
+)
+
+// date formats of the authorization expiry
+var licenseDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "Mon Jan 2 15:04:05 MST 2006", "Jan 2 15:04:05 2006 MST", "Jan 2 2006 15:04:05", "2006-01-02", "Jan 2 2006"}
+
+// request the Smart Licensing status of the cluster via AXL on the publisher
+// and return the response elements by lower case name, see the element lists
+func getSmartLicenseStatus(ipAddr string) (map[string]string, error) {
+	request := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns="http://www.cisco.com/AXL/API/%s"><soapenv:Header/><soapenv:Body><ns:getSmartLicenseStatus/></soapenv:Body></soapenv:Envelope>`, apiVersion)
+	debugPrintf(3, "AXL SOAP request: %s\n", request)
+
+	resp, body, _, err := soapRequest(ipAddr, "/axl/", "CUCM:DB ver="+apiVersion+" getSmartLicenseStatus", request)
+	if err != nil {
+		return nil, err
+	}
+	debugPrintf(3, "AXL SOAP response: %s\n", body)
+
+	elements := map[string]string{}
+	path := []string{}
+	text := ""
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("AXL XML unmarshal error: %s", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, strings.ToLower(t.Name.Local))
+			text = ""
+		case xml.CharData:
+			text += string(t)
+		case xml.EndElement:
+			if value := strings.TrimSpace(text); value != "" {
+				name := path[len(path)-1]
+				if len(path) > 1 {
+					elements[path[len(path)-2]+"/"+name] = value
+				}
+				if _, found := elements[name]; !found {
+					elements[name] = value
+				}
+			}
+			path = path[:len(path)-1]
+			text = ""
+		}
+	}
+
+	if fault := elements["faultstring"]; fault != "" {
+		return nil, fmt.Errorf("AXL fault: %s", fault)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AXL HTTP status: %s", resp.Status)
+	}
+	return elements, nil
+}
+
+// first of the names found in the response elements
+func licenseElement(elements map[string]string, names []string) string {
+	for _, name := range names {
+		if value, found := elements[name]; found {
+			return value
+		}
+	}
+	return ""
+}
+
+// return value of a registration or authorization state: registered and
+// authorized are OK, the evaluation period WARNING, expired, out of
+// compliance and enforcement CRITICAL. unknown states are a WARNING.
+func licenseStateReturnVal(state string) int {
+	s := strings.ToLower(state)
+	switch {
+	case strings.Contains(s, "expired"), strings.Contains(s, "compliance"), strings.Contains(s, "enforce"),
+		strings.Contains(s, "no license"), strings.Contains(s, "not authorized"), strings.Contains(s, "unauthorized"):
+		return 2
+	case strings.Contains(s, "eval"), strings.Contains(s, "unregistered"), strings.Contains(s, "unidentified"):
+		return 1
+	case strings.Contains(s, "registered"), strings.Contains(s, "authorized"):
+		return 0
+	}
+	return 1
+}
+
+// days until a Smart Licensing date, or a number of days like "89 days"
+func licenseDays(value string, now time.Time) (float64, bool) {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		if days, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			return days, true
+		}
+	}
+	for _, layout := range licenseDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return float64(int(t.Sub(now).Hours() / 24)), true
+		}
+	}
+	return 0, false
+}
+
+// check the Smart Licensing registration and authorization of the cluster
+// and the days until the authorization or the evaluation period expires,
+// -w and -c override the default day ranges. the license usage is not
+// checked, CUCM enforces the licenses once the authorization expired.
+func checkSmartLicense() *checkResult {
+	elements, err := getSmartLicenseStatus(ipAddr)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("%s Smart Licensing status: %s", outputPrefix, err)}
+	}
+	registration := licenseElement(elements, licenseRegistrationElements)
+	authorization := licenseElement(elements, licenseAuthorizationElements)
+	if registration == "" && authorization == "" {
+		return &checkResult{returnVal: 3, text: fmt.Sprintf("%s Smart Licensing status: no registration or authorization status in the AXL response", outputPrefix)}
+	}
+
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+	if mode := licenseElement(elements, licenseModeElements); mode != "" {
+		longOutput = append(longOutput, "license mode: "+mode)
+	}
+	for _, s := range []struct{ name, state string }{{"registration", registration}, {"authorization", authorization}} {
+		if s.state == "" {
+			longOutput = append(longOutput, s.name+" n/a")
+			continue
+		}
+		returnVal := licenseStateReturnVal(s.state)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s %s %s", s.name, s.state, returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s %s", s.name, s.state, returnValText(returnVal)))
+	}
+
+	warning, critical := licenseExpiryWarning, licenseExpiryCritical
+	if thresholdGiven("w") {
+		warning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		critical = criticalThreshold
+	}
+	for _, d := range []struct {
+		name, label string
+		names       []string
+	}{
+		{"authorization expires", "authorization_expiry_days", licenseExpiryElements},
+		{"evaluation period", "evaluation_days_left", licenseEvaluationElements},
+	} {
+		value := licenseElement(elements, d.names)
+		if value == "" {
+			continue
+		}
+		days, ok := licenseDays(value, now)
+		if !ok {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s, days n/a", d.name, value))
+			continue
+		}
+		returnVal := getNagiosReturnVal(days, warning, critical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s in %.0f days %s", d.name, days, returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata, fmt.Sprintf("%s=%.0f;%s;%s;;", d.label, days, warning, critical))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s (%.0f days) %s", d.name, value, days, returnValText(returnVal)))
+	}
+
+	summary := strings.Trim(registration+", "+authorization, ", ")
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s Smart Licensing: %s", outputPrefix, summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode smart-license
+func dryRunSmartLicense(object string) (*dryRunPlan, error) {
+	plan := &dryRunPlan{}
+	for _, apiHost := range apiHosts(ipAddr) {
+		plan.lines = append(plan.lines, fmt.Sprintf("endpoint: https://%s:8443/axl/", apiHost))
+	}
+	warning, critical := licenseExpiryWarning, licenseExpiryCritical
+	if thresholdGiven("w") {
+		warning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		critical = criticalThreshold
+	}
+	plan.lines = append(plan.lines, "SOAPAction: CUCM:DB ver="+apiVersion+" getSmartLicenseStatus",
+		fmt.Sprintf("authorization expiry days warning: %s critical: %s", warning, critical))
+	return plan, nil
+}
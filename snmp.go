@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// BER encoding of a type-length-value
+func berTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	b := []byte{tag}
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+	return append(b, content...)
+}
+
+// BER encoding of an integer type like INTEGER or TimeTicks
+func berInt(tag byte, v int64) []byte {
+	b := []byte{}
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(tag, b)
+}
+
+func berString(s string) []byte {
+	return berTLV(0x04, []byte(s))
+}
+
+func berSequence(parts ...[]byte) []byte {
+	return berTLV(0x30, bytes.Join(parts, nil))
+}
+
+// BER encoding of a dotted OBJECT IDENTIFIER
+func berOID(oid string) ([]byte, error) {
+	ids := []uint64{}
+	for _, part := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %s", oid)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("invalid OID %s", oid)
+	}
+
+	content := []byte{byte(ids[0]*40 + ids[1])}
+	for _, id := range ids[2:] {
+		enc := []byte{byte(id & 0x7f)}
+		for id >>= 7; id > 0; id >>= 7 {
+			enc = append([]byte{byte(id&0x7f) | 0x80}, enc...)
+		}
+		content = append(content, enc...)
+	}
+	return berTLV(0x06, content), nil
+}
+
+// SNMPv2-Trap-PDU with sysUpTime in hundredths of a second, snmpTrapOID and
+// the check varbinds
+func snmpTrapPDU(upTime int64, key string, returnVal, previousReturnVal int, output string) ([]byte, error) {
+	sysUpTime, _ := berOID(oidSysUpTime)
+	trapOIDName, _ := berOID(oidSnmpTrapOID)
+	trapOID, err := berOID(snmpTrapOID)
+	if err != nil {
+		return nil, err
+	}
+
+	varbinds := [][]byte{
+		berSequence(sysUpTime, berInt(0x43, upTime&0xffffffff)),
+		berSequence(trapOIDName, trapOID),
+	}
+	values := [][]byte{
+		berString(ipAddr),
+		berString(key),
+		berInt(0x02, int64(returnVal)),
+		berInt(0x02, int64(previousReturnVal)),
+		berString(output),
+	}
+	for i, value := range values {
+		oid, err := berOID(fmt.Sprintf("%s.%d", snmpTrapOID, i+1))
+		if err != nil {
+			return nil, err
+		}
+		varbinds = append(varbinds, berSequence(oid, value))
+	}
+
+	requestID := time.Now().UnixNano() & 0x7fffffff
+	return berTLV(0xa7, bytes.Join([][]byte{berInt(0x02, requestID), berInt(0x02, 0), berInt(0x02, 0), berSequence(varbinds...)}, nil)), nil
+}
+
+// localize a SNMPv3 passphrase to a key of the engine ID (RFC 3414 A.2)
+func snmpLocalizeKey(h func() hash.Hash, passphrase string, engineID []byte) []byte {
+	d := h()
+	buf := make([]byte, 64)
+	for count := 0; count < 1048576; count += 64 {
+		for i := range buf {
+			buf[i] = passphrase[(count+i)%len(passphrase)]
+		}
+		d.Write(buf)
+	}
+	ku := d.Sum(nil)
+
+	d = h()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
+
+// SNMPv3 authoritative engine ID of the trap sender
+func snmpV3EngineID() ([]byte, error) {
+	if snmpEngineID != "" {
+		return hex.DecodeString(strings.TrimPrefix(snmpEngineID, "0x"))
+	}
+	// net-snmp enterprise number, format text
+	hostname, _ := os.Hostname()
+	return append([]byte{0x80, 0x00, 0x1f, 0x88, 0x04}, []byte(hostname)...), nil
+}
+
+// persistent snmpEngineBoots of an engine ID and the time they were incremented
+type snmpEngineState struct {
+	Boots int64
+	Since int64
+}
+
+// snmpEngineBoots and snmpEngineTime of the trap sender (RFC 3414 2.2). the
+// boots are kept in the state dir and incremented if they are missing, the
+// clock went back or the engine time would overflow. the engine time is the
+// seconds since, so the receivers see a monotonic clock across the runs.
+func snmpEngineClock(engineID []byte, now time.Time) (int64, int64) {
+	filename := filepath.Join(stateDir, fmt.Sprintf("%s%d_snmp_engine_%x.json", chacheFilePrefix, os.Getuid(), engineID))
+	state := snmpEngineState{}
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.Boots < 1 || now.Unix() < state.Since || now.Unix()-state.Since > math.MaxInt32 {
+		if state.Boots < math.MaxInt32 {
+			state.Boots++
+		}
+		state.Since = now.Unix()
+		data, _ := json.Marshal(state)
+		err := os.MkdirAll(stateDir, 0755)
+		if err == nil {
+			err = writeFileAtomic(filename, data, 0600)
+		}
+		if err != nil {
+			debugPrintf(1, "SNMP engine boots file %s error: %s\n", filename, err)
+		}
+	}
+	return state.Boots, now.Unix() - state.Since
+}
+
+// SNMPv3 message with USM security, authenticated and encrypted depending
+// on the configured passphrases
+func snmpV3Message(pdu, engineID []byte, engineBoots, engineTime int64) ([]byte, error) {
+	var hashFunc func() hash.Hash
+	switch strings.ToUpper(snmpAuthProto) {
+	case "MD5":
+		hashFunc = md5.New
+	case "SHA":
+		hashFunc = sha1.New
+	default:
+		return nil, fmt.Errorf("unknown SNMP authentication protocol: %s", snmpAuthProto)
+	}
+	if snmpPrivPass != "" && snmpAuthPass == "" {
+		return nil, fmt.Errorf("SNMP privacy requires an authentication passphrase")
+	}
+
+	flags := byte(0)
+	authParams := []byte{}
+	privParams := []byte{}
+	msgData := berSequence(berTLV(0x04, engineID), berString(""), pdu)
+
+	if snmpAuthPass != "" {
+		flags |= 0x01
+		authParams = make([]byte, 12)
+	}
+	if snmpPrivPass != "" {
+		flags |= 0x02
+		privKey := snmpLocalizeKey(hashFunc, snmpPrivPass, engineID)[:16]
+		privParams = make([]byte, 8)
+		if _, err := rand.Read(privParams); err != nil {
+			return nil, err
+		}
+		// AES-128-CFB with IV engine boots, engine time and salt (RFC 3826)
+		iv := make([]byte, 8, 16)
+		binary.BigEndian.PutUint32(iv[0:4], uint32(engineBoots))
+		binary.BigEndian.PutUint32(iv[4:8], uint32(engineTime))
+		iv = append(iv, privParams...)
+		block, err := aes.NewCipher(privKey)
+		if err != nil {
+			return nil, err
+		}
+		encrypted := make([]byte, len(msgData))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, msgData)
+		msgData = berTLV(0x04, encrypted)
+	}
+
+	usmPrefix := bytes.Join([][]byte{berTLV(0x04, engineID), berInt(0x02, engineBoots), berInt(0x02, engineTime), berString(snmpUser)}, nil)
+	usmContent := bytes.Join([][]byte{usmPrefix, berTLV(0x04, authParams), berTLV(0x04, privParams)}, nil)
+	usm := berTLV(0x30, usmContent)
+
+	msgID := time.Now().UnixNano() & 0x7fffffff
+	globalData := berSequence(berInt(0x02, msgID), berInt(0x02, 65507), berTLV(0x04, []byte{flags}), berInt(0x02, 3))
+	msg := berSequence(berInt(0x02, 3), globalData, berTLV(0x04, usm), msgData)
+
+	if snmpAuthPass != "" {
+		mac := hmac.New(hashFunc, snmpLocalizeKey(hashFunc, snmpAuthPass, engineID))
+		mac.Write(msg)
+		pos := bytes.Index(msg, usm) + len(usm) - len(usmContent) + len(usmPrefix) + 2
+		copy(msg[pos:pos+12], mac.Sum(nil)[:12])
+	}
+	return msg, nil
+}
+
+// send a SNMPv2c or SNMPv3 trap about the state change of a check
+func sendSnmpTrap(key string, returnVal, previousReturnVal int, output string) error {
+	if len(output) > 1024 {
+		output = output[:1024]
+	}
+	engineID, err := snmpV3EngineID()
+	if err != nil {
+		return fmt.Errorf("invalid SNMP engine ID: %s", err)
+	}
+	// sysUpTime is the engine time of the trap sender
+	engineBoots, engineTime := snmpEngineClock(engineID, time.Now())
+	pdu, err := snmpTrapPDU(engineTime*100, key, returnVal, previousReturnVal, output)
+	if err != nil {
+		return err
+	}
+
+	msg := []byte{}
+	switch snmpVersion {
+	case "2c":
+		msg = berSequence(berInt(0x02, 1), berString(snmpCommunity), pdu)
+	case "3":
+		if msg, err = snmpV3Message(pdu, engineID, engineBoots, engineTime); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown SNMP version: %s", snmpVersion)
+	}
+
+	target := snmpTrapTarget
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "162")
+	}
+	conn, err := net.DialTimeout("udp", target, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	debugPrintf(3, "SNMP trap to %s: %x\n", target, msg)
+	_, err = conn.Write(msg)
+	return err
+}
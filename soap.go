@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// default namespaces of the PerfmonPort and RisPort SOAP envelopes
+const (
+	defaultSOAPEnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	defaultSOAPNamespace         = "http://schemas.cisco.com/ast/soap"
+)
+
+// SOAPAction header of the PerfmonPort requests, {version} is replaced with -A
+func perfmonSOAPAction() string {
+	return strings.Replace(soapAction, "{version}", apiVersion, -1)
+}
+
+// SOAP envelope of a PerfmonPort or RisPort request body with soap: prefixed
+// elements. with -soap-no-prefix the prefixes are removed and the namespace
+// is the default namespace of the operation element.
+func soapEnvelope(body string) string {
+	if soapNoPrefix {
+		body = strings.Replace(strings.Replace(body, "</soap:", "</", -1), "<soap:", "<", -1)
+		if i := strings.IndexAny(body, " />"); i > 0 {
+			body = body[:i] + fmt.Sprintf(` xmlns="%s"`, soapNamespace) + body[i:]
+		}
+		return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?><soapenv:Envelope xmlns:soapenv="%s"><soapenv:Header/><soapenv:Body>%s</soapenv:Body></soapenv:Envelope>`, soapEnvelopeNamespace, body)
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?><soapenv:Envelope xmlns:soapenv="%s" xmlns:soap="%s"><soapenv:Header/><soapenv:Body>%s</soapenv:Body></soapenv:Envelope>`, soapEnvelopeNamespace, soapNamespace, body)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// nagios host and service of a result, {node} is replaced with the node
+func checkResultTarget(node string) (string, string) {
+	host := checkResultHost
+	if host == "" {
+		host = node
+	}
+	return strings.Replace(host, "{node}", node, -1), strings.Replace(checkResultService, "{node}", node, -1)
+}
+
+// write a passive service check result to the nagios checkresults spool
+// directory. the file is moved into place before the .ok file is created, so
+// nagios never reads a partial result.
+func writeCheckResult(node string, r *checkResult) error {
+	if checkResultService == "" {
+		return fmt.Errorf("-checkresult-service is required with -checkresults-dir")
+	}
+	host, service := checkResultTarget(node)
+	now := time.Now()
+	output := strings.Replace(formatResult(r), "\n", "\\n", -1)
+
+	content := fmt.Sprintf("### Passive Check Result File ###\nfile_time=%d\n\n### Nagios Service Check Result ###\n# Time: %s\nhost_name=%s\nservice_description=%s\ncheck_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\nlatency=0.0\nstart_time=%d.%06d\nfinish_time=%d.%06d\nearly_timeout=0\nexited_ok=1\nreturn_code=%d\noutput=%s\n",
+		now.Unix(), now.Format(time.ANSIC), host, service, startTime.Unix(), startTime.Nanosecond()/1000, now.Unix(), now.Nanosecond()/1000, r.returnVal, output)
+
+	// nagios only reads files starting with c, the temp file is ignored until renamed
+	tmp, err := ioutil.TempFile(checkResultsDir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.WriteString(content); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	filename := filepath.Join(checkResultsDir, "c"+strings.TrimPrefix(filepath.Base(tmp.Name()), "tmp"))
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	debugPrintf(3, "check result written: %s %s/%s\n", filename, host, service)
+	return ioutil.WriteFile(filename+".ok", nil, 0644)
+}
+
+// write a result to the spool directory and submit it to the Icinga2 API, if configured
+func submitResult(node string, r *checkResult) error {
+	if checkResultsDir != "" {
+		if err := writeCheckResult(node, r); err != nil {
+			return fmt.Errorf("check result spool error: %s", err)
+		}
+	}
+	if icinga2API != "" {
+		if err := postIcinga2Result(node, r); err != nil {
+			return fmt.Errorf("Icinga2 API error: %s", err)
+		}
+	}
+	return nil
+}
+
+// query the counter on every node and write or submit one check result per
+// node. returns a summary of the submitted results.
+func submitNodeResults(nodes []string, object string) *checkResult {
+	combinedReturnVal := 0
+	results := []*checkResult{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		r := queryHost(ipAddr, node, object, counterName, objectInstance)
+		if r == nil {
+			return &checkResult{returnVal: 3, text: "no counter name given, use -n"}
+		}
+		if err := submitResult(node, r); err != nil {
+			r = &checkResult{node: node, returnVal: 3, text: err.Error()}
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, r.returnVal)
+		results = append(results, r)
+		_, service := checkResultTarget(node)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", service, returnValText(r.returnVal), r.text))
+	}
+	checkResultsWritten = true
+
+	return &checkResult{
+		returnVal:  combinedReturnVal,
+		text:       fmt.Sprintf("%s check results submitted, %s", outputPrefix, nodeSummaryText(results)),
+		longOutput: longOutput,
+	}
+}
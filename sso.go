@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Tomcat web application counters of the SAML SSO service provider
+	ssoObject         = "Cisco Tomcat Web Application"
+	ssoObjectInstance = "Cisco Tomcat Web Application(ssosp)"
+	// redirects followed until the identity provider is reached
+	ssoMaxRedirects = 10
+)
+
+// follow the redirects of the -sso-path admin page of a node without
+// credentials. with SAML SSO enabled they lead via /ssosp to the identity
+// provider, which has to answer. returns the IdP host, or an error if SSO is
+// broken or the node offers the local login form instead.
+func ssoRedirect(node string) (string, error) {
+	noRedirect := func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	client := newHTTPClient()
+	client.Timeout, client.CheckRedirect = 20*time.Second, noRedirect
+	// the identity provider is verified with the system CAs and doesn't
+	// need the TLS settings of the CUCM Tomcat
+	idpClient := &http.Client{
+		Timeout:       20 * time.Second,
+		CheckRedirect: noRedirect,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: fipsTLSConfig(&tls.Config{})},
+	}
+
+	location := "https://" + node + ":8443" + ssoPath
+	for i := 0; i < ssoMaxRedirects; i++ {
+		debugPrintf(3, "SSO request: %s\n", location)
+		get := client.Get
+		if u, err := url.Parse(location); err == nil && u.Hostname() != node {
+			get = idpClient.Get
+		}
+		resp, err := get(location)
+		if err != nil {
+			return "", fmt.Errorf("HTTPS request error: %s", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		u := resp.Request.URL
+
+		if u.Hostname() != node {
+			// the identity provider login page
+			if resp.StatusCode >= 400 {
+				return u.Hostname(), fmt.Errorf("identity provider %s HTTP status %s", u.Hostname(), resp.Status)
+			}
+			return u.Hostname(), nil
+		}
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			next, err := u.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				return "", fmt.Errorf("invalid redirect of %s: %s", u.Path, err)
+			}
+			location = next.String()
+			continue
+		case strings.Contains(u.Path, "/ssosp/local/") || strings.Contains(string(body), "j_security_check"):
+			return "", fmt.Errorf("local login form at %s, SSO disabled or falling back to local authentication", u.Path)
+		case resp.StatusCode != http.StatusOK:
+			return "", fmt.Errorf("%s HTTP status %s", u.Path, resp.Status)
+		}
+		return "", fmt.Errorf("%s answered without redirect to an identity provider", u.Path)
+	}
+	return "", fmt.Errorf("more than %d redirects from %s", ssoMaxRedirects, ssoPath)
+}
+
+// check the SAML SSO of every node: the admin pages have to redirect to a
+// reachable identity provider, the local login form is CRITICAL as users
+// can't log into Self Care and the admin pages with their SSO accounts.
+// the request errors of the ssosp web application are added per minute,
+// -w and -c apply to them if given.
+func checkSSO(nodes []string) *checkResult {
+	state := currentCheckState()
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, problemPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, problemPrefix = node+"/", node+" "
+		}
+
+		idp, err := ssoRedirect(node)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 2)
+			problems = append(problems, fmt.Sprintf("%sSSO broken: %s", problemPrefix, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(2), err))
+		} else {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s redirects to identity provider %s", node, returnValText(0), ssoPath, idp))
+		}
+
+		// rates need the current value
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, ssoObject)
+		if err != nil {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s n/a: %s", node, ssoObjectInstance, err))
+			continue
+		}
+		if valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, ssoObjectInstance, "SessionsActive")); found {
+			perfdata = append(perfdata, fmt.Sprintf("%sssosp_sessions=%s;;;0;", labelPrefix, valueText))
+		}
+		valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, ssoObjectInstance, "Errors"))
+		value, err := strconv.ParseFloat(valueText, 64)
+		if !found || err != nil {
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s\\Errors n/a", node, ssoObjectInstance))
+			continue
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%sssosp_errors=%sc;;;0;", labelPrefix, valueText))
+		if state == nil {
+			continue
+		}
+		rate, ok := counterRate(state, "sso "+node, value, now)
+		if !ok {
+			longOutput = append(longOutput, fmt.Sprintf("%s: ssosp errors %s total, rate n/a, first run", node, valueText))
+			continue
+		}
+		warning, critical := givenThresholds()
+		returnVal := givenThresholdsReturnVal(rate, warning, critical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%sssosp errors %.2f per minute %s", problemPrefix, rate, returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata, fmt.Sprintf("%sssosp_errors_per_min=%.2f;%s;%s;0;", labelPrefix, rate, warning, critical))
+		longOutput = append(longOutput, fmt.Sprintf("%s: ssosp errors %.2f per minute %s", node, rate, returnValText(returnVal)))
+	}
+
+	summary := "SSO redirects to the identity provider"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s SAML SSO %d nodes: %s", outputPrefix, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode sso
+func dryRunSSO(object string) (*dryRunPlan, error) {
+	warning, critical := givenThresholds()
+	if warning != "" {
+		warning += " per minute"
+	}
+	if critical != "" {
+		critical += " per minute"
+	}
+	return &dryRunPlan{
+		queries: []dryRunQuery{{ssoObject, ssoObjectInstance, "Errors", warning, critical}, {ssoObject, ssoObjectInstance, "SessionsActive", "", ""}},
+		nodeLines: func(node string) []string {
+			return []string{fmt.Sprintf("SSO redirects: https://%s:8443%s to the identity provider", node, ssoPath)}
+		},
+		uncached: true,
+	}, nil
+}
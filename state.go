@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	maxStateSamples  = 100
+	stateLockTimeout = 5 * time.Second
+	stateLockStale   = 60 * time.Second
+)
+
+type (
+	// persistent state of a check shared by all features depending on previous runs
+	CheckState struct {
+		Key       string
+		ReturnVal int    // last evaluated state
+		Value     string // last value
+		Time      int64
+		Samples   []StateSample     // previous values, newest last
+		Data      map[string]string // feature specific values
+
+		exists   bool
+		lockFile string
+	}
+
+	StateSample struct {
+		Time      int64
+		Value     float64
+		ReturnVal int
+	}
+)
+
+// state of the current check, opened on first use and saved by exitWithResult
+var checkState *CheckState
+
+// identifies a check for state tracking, built from the target and counter parameters
+func checkKey() string {
+	mode := "counter"
+	switch {
+	case clusterList != "" || clustersFile != "":
+		mode = "clusters " + clusterList + " " + clustersFile
+	case checkMode == "rtmt":
+		mode = "rtmt " + rtmtAlertList
+	case checkMode != "":
+		mode = checkMode
+	case nodeAggregate != "":
+		mode = "aggregate " + nodeAggregate
+	}
+
+	nodes := nodeIpAddr
+	if allNodes {
+		nodes = "all-nodes"
+	} else if nodesIpAddrs != "" {
+		nodes = nodesIpAddrs
+	}
+	return fmt.Sprintf("%s %s %s %s %s", mode, ipAddr, nodes, objectInstance, counterName)
+}
+
+// state file name of a check key
+func stateFileName(key string) string {
+	return filepath.Join(stateDir, fmt.Sprintf("%s%d_%x.json", chacheFilePrefix, os.Getuid(), md5.Sum([]byte(key))))
+}
+
+// acquire the lock file of a state file. stale locks of crashed runs are removed.
+func lockState(lockFile string) error {
+	deadline := time.Now().Add(stateLockTimeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return f.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if fs, err := os.Stat(lockFile); err == nil && time.Since(fs.ModTime()) > stateLockStale {
+			debugPrintf(2, "removing stale state lock file: %s\n", lockFile)
+			os.Remove(lockFile)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for state lock %s", lockFile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// load and lock the state of a check. the lock is held until saveState or releaseState.
+func loadState(key string) (*CheckState, error) {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+	filename := stateFileName(key)
+	state := &CheckState{Key: key, Data: map[string]string{}, lockFile: filename + ".lock"}
+	if err := lockState(state.lockFile); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, state)
+	}
+	if err != nil {
+		debugPrintf(1, "state file %s error: %s\n", filename, err)
+		return state, nil
+	}
+	if state.Data == nil {
+		state.Data = map[string]string{}
+	}
+	state.exists = true
+	return state, nil
+}
+
+// atomically write the state file and release the lock
+func saveState(state *CheckState) error {
+	defer releaseState(state)
+
+	if len(state.Samples) > maxStateSamples {
+		state.Samples = state.Samples[len(state.Samples)-maxStateSamples:]
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(stateFileName(state.Key), data, 0600)
+}
+
+// release the lock of a state without saving
+func releaseState(state *CheckState) {
+	if state.lockFile != "" {
+		os.Remove(state.lockFile)
+		state.lockFile = ""
+	}
+}
+
+// state of the current check, nil if the state file can't be used
+func currentCheckState() *CheckState {
+	if checkState == nil {
+		state, err := loadState(checkKey())
+		if err != nil {
+			debugPrintf(1, "state error: %s\n", err)
+			return nil
+		}
+		checkState = state
+	}
+	return checkState
+}
+
+// append a sample of the evaluated value to the state
+func addStateSample(state *CheckState, value float64, returnVal int) {
+	state.Samples = append(state.Samples, StateSample{Time: time.Now().Unix(), Value: value, ReturnVal: returnVal})
+}
+
+// append a state change to the event log: timestamp, check, old state, new state and value tab separated
+func writeEvent(key string, oldReturnVal, newReturnVal int, value string) error {
+	f, err := os.OpenFile(eventLogFileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), key, returnValText(oldReturnVal), returnValText(newReturnVal), value)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// check that the -n counter of every node changes between runs, e.g.
+// CallsCompleted or the CDR records written of a service that looks healthy
+// but hangs. the last value and the number of runs it was seen are kept in the
+// state file, a value identical in -stuck-runs consecutive runs is CRITICAL.
+// -w and -c are ranges of the unchanged runs instead if given.
+func checkStuck(nodes []string, object string) *checkResult {
+	if counterName == "" {
+		return &checkResult{returnVal: 3, text: "stuck counter check needs a counter, use -o object -n counter"}
+	}
+	if stuckRuns < 2 {
+		return &checkResult{returnVal: 3, text: "-stuck-runs must be at least 2"}
+	}
+	state := currentCheckState()
+	if state == nil {
+		return &checkResult{returnVal: 3, text: "stuck counter check needs the state file, see -state-dir"}
+	}
+	// without -c CRITICAL after -stuck-runs unchanged runs
+	warning, critical := givenThresholds()
+	if critical == "" {
+		critical = fmt.Sprintf("%d", stuckRuns-1)
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, problemPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, problemPrefix = node+"/", node+" "
+		}
+		// always fetched, a cached response would look like a stuck counter
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+		valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, objectInstance, counterName))
+		if !found {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s%s n/a", problemPrefix, counterName))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s\\%s n/a", node, returnValText(3), objectInstance, counterName))
+			continue
+		}
+		valueText = counterValueText(valueText)
+
+		runs, status := unchangedRuns(state, "stuck "+node+" "+objectInstance+"\\"+counterName, valueText)
+		returnVal := givenThresholdsReturnVal(float64(runs), warning, critical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s%s=%s unchanged in %d runs", problemPrefix, counterName, valueText, runs))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata, fmt.Sprintf("%sunchanged_runs=%d;%s;%s;0;", labelPrefix, runs, warning, critical))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s=%s %s", node, returnValText(returnVal), counterName, valueText, status))
+	}
+
+	summary := "not stuck"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s,%s,%s %d nodes: %s", outputPrefix, objectInstance, counterName, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// compare a counter value with the last value and the number of consecutive
+// runs it was seen, kept in the state data under key. returns the runs
+// including this one with the value and the status text.
+func unchangedRuns(state *CheckState, key, valueText string) (int, string) {
+	runs, status := 1, "first run, no previous value"
+	if i := strings.LastIndex(state.Data[key], " "); i > 0 {
+		lastRuns, _ := strconv.Atoi(state.Data[key][i+1:])
+		if state.Data[key][:i] == valueText {
+			runs = lastRuns + 1
+			status = fmt.Sprintf("unchanged in %d runs", runs)
+		} else {
+			status = fmt.Sprintf("changed from %s", state.Data[key][:i])
+		}
+	}
+	state.Data[key] = fmt.Sprintf("%s %d", valueText, runs)
+	return runs, status
+}
+
+// -dry-run plan of -mode stuck
+func dryRunStuck(object string) (*dryRunPlan, error) {
+	if counterName == "" {
+		return nil, fmt.Errorf("no counter name given, use -n")
+	}
+	warning, critical := givenThresholds()
+	if warning != "" {
+		warning += " unchanged runs"
+	}
+	if critical != "" {
+		critical += " unchanged runs"
+	} else {
+		critical = fmt.Sprintf("unchanged in %d runs", stuckRuns)
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, objectInstance, counterName, warning, critical}}, uncached: true}, nil
+}
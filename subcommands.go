@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// subcommand with its own flag set, made of the plugin flags it uses
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	flags   []string // nil for all flags except the flags of other subcommands
+}
+
+// flags of the connection to the server and the cache, used by every
+// subcommand contacting a server
+var connectionFlags = []string{"H", "u", "p", "A", "product", "d", "L", "C", "m", "cache-ages", "no-cache", "cache-gzip", "catalog-cache-age",
+	"transport", "rest-path", "soap-action", "soap-envelope-ns", "soap-ns", "soap-no-prefix", "session-reuse", "session-ttl", "oauth-token-url", "oauth-client-id", "oauth-client-secret", "oauth-scope", "oauth-grant", "replay", "record", "ca", "fips"}
+
+var subcommands = []subcommand{
+	{"check", "[flags]", "Check a counter or a -mode, the default without subcommand", nil},
+	{"list", "[flags]", "Print the perfmon objects and counters of a node (-l)", append([]string{"N"}, connectionFlags...)},
+	{"describe", "[flags]", "Print the description of the -o object -n counter of a node", append([]string{"N", "o", "i", "instance", "n"}, connectionFlags...)},
+	{"discover", "[flags]", "Print the cluster nodes discovered via AXL on the -H publisher, one per line as for -M @filename", connectionFlags},
+	{"daemon", "-serve address [flags]", "Serve checks over HTTPS (-serve), the further flags are the defaults of the checks", nil},
+	{"cache", "prune [flags]", "Prune the cache files by -cache-max-age and -cache-max-size (-prune-cache)", []string{"d", "L", "C", "cache-max-age", "cache-max-size"}},
+}
+
+// flags replaced by a subcommand, only accepted without subcommand
+var subcommandFlags = []string{"l", "serve", "prune-cache"}
+
+var (
+	command     = "check" // subcommand of the run
+	commandArgs []string  // arguments after the flags of the subcommand
+)
+
+func subcommandOf(name string) *subcommand {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// flag set of a subcommand sharing the values of the plugin flags
+func subcommandFlagSet(sub *subcommand) *flag.FlagSet {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" "+sub.name, flag.ExitOnError)
+	add := func(f *flag.Flag) {
+		for _, name := range subcommandFlags {
+			if f.Name == name && !(sub.name == "daemon" && name == "serve") {
+				return
+			}
+		}
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	if sub.flags == nil {
+		flag.VisitAll(add)
+	} else {
+		for _, name := range sub.flags {
+			add(flag.Lookup(name))
+		}
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\n", filepath.Base(os.Args[0]), sub.name, sub.args, sub.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// usage of the plugin without subcommand: the subcommands and all flags
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s: [subcommand] [flags]\n", os.Args[0])
+	for _, sub := range subcommands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s %s\n    \t%s\n", sub.name, sub.args, sub.summary)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "flags without subcommand, see %s <subcommand> -h for the flags of a subcommand:\n", filepath.Base(os.Args[0]))
+	flag.PrintDefaults()
+}
+
+// parse the command line, a subcommand as first argument or the legacy flags
+// only. the legacy -l, -serve and -prune-cache select their subcommand, the
+// -extra-opts arguments are replaced with the options of their ini sections.
+func parseCommandLine() {
+	flag.Usage = usage
+	if len(os.Args) < 2 || subcommandOf(os.Args[1]) == nil {
+		extra, rest, err := expandExtraOpts(os.Args[1:])
+		if err != nil {
+			fmt.Printf("%s - %s\n", returnValText(3), err)
+			os.Exit(3)
+		}
+		flag.CommandLine.Parse(append(extra, rest...))
+		commandArgs = flag.Args()
+		switch {
+		case serveAddr != "":
+			command = "daemon"
+		case pruneCache:
+			command, commandArgs = "cache", []string{"prune"}
+		case showCounters:
+			command = "list"
+		}
+		return
+	}
+
+	sub := subcommandOf(os.Args[1])
+	fs := subcommandFlagSet(sub)
+	extra, rest, err := expandExtraOpts(os.Args[2:])
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		os.Exit(3)
+	}
+	// the ini sections are shared by all subcommands, options of other
+	// subcommands are skipped
+	args := []string{}
+	for _, arg := range extra {
+		if fs.Lookup(argFlagName(arg)) != nil {
+			args = append(args, arg)
+		}
+	}
+	fs.Parse(append(args, rest...))
+	// set the given flags on the plugin flags too, flagGiven checks them
+	fs.Visit(func(f *flag.Flag) {
+		flag.Set(f.Name, f.Value.String())
+	})
+	command, commandArgs = sub.name, fs.Args()
+
+	switch command {
+	case "list":
+		showCounters = true
+	case "daemon":
+		if serveAddr == "" {
+			fmt.Fprintf(fs.Output(), "daemon: no listen address given, use -serve\n")
+			fs.Usage()
+			os.Exit(3)
+		}
+	}
+}
+
+// cache subcommand, prune is the only action for now
+func runCacheCommand(args []string) int {
+	if len(args) != 1 || args[0] != "prune" {
+		fmt.Printf("%s - cache: unknown action: %s, use prune\n", returnValText(3), strings.Join(args, " "))
+		return 3
+	}
+	removed, removedBytes, err := pruneCacheFiles(time.Now())
+	if err != nil {
+		fmt.Printf("%s - cache prune: %s\n", returnValText(3), err)
+		return 3
+	}
+	fmt.Printf("%s - cache pruned: %d files, %d bytes removed\n", returnValText(0), removed, removedBytes)
+	return 0
+}
+
+// discover subcommand
+func runDiscover() int {
+	nodes, err := discoverNodes(ipAddr)
+	if err != nil {
+		fmt.Printf("%s - AXL node discovery failed: %s\n", returnValText(3), err)
+		return 3
+	}
+	fmt.Println(strings.Join(nodes, "\n"))
+	return 0
+}
+
+// describe subcommand
+func runDescribe() int {
+	if counterName == "" {
+		fmt.Printf("%s - describe: no counter name given, use -n\n", returnValText(3))
+		return 3
+	}
+	fullCounterName := getFullCounterName(nodeIpAddr, objectInstance, counterName)
+	description, err := counterDescription(ipAddr, nodeIpAddr, fullCounterName)
+	if err != nil {
+		fmt.Printf("%s - %s\n", returnValText(3), err)
+		return 3
+	}
+	fmt.Printf("%s\n%s\n", fullCounterName, strings.TrimSpace(description))
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const maxSuggestions = 3
+
+// edit distance of two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// full counter names of the collected object and of the cached counter catalog
+func counterCandidates(counterEnvelope *CounterEnvelope, nodeIpAddr, objectInstance string) []string {
+	candidates := []string{}
+	for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+		candidates = append(candidates, v.Name.Text)
+	}
+
+	// only an already cached catalog is used, a typo must not cost an extra request
+	catalog := new(ListCounterEnvelope)
+	if catalogCacheAge > 0 && loadStruct(nodeIpAddr, "perfmonListCounter", catalogCacheAge, catalog) {
+		object := perfmonObject(objectInstance)
+		for _, o := range catalog.Body.PerfmonListCounterResponse.ArrayOfObjectInfo.ArrayOfObjectInfo {
+			if !strings.EqualFold(o.Name.Text, object) {
+				continue
+			}
+			for _, c := range o.ArrayOfCounter.ArrayOfCounter {
+				candidates = append(candidates, getFullCounterName(nodeIpAddr, objectInstance, c.Name.Text))
+			}
+		}
+	}
+	return candidates
+}
+
+// nearest matches of a counter name not found, best first
+func suggestCounters(fullCounterName string, candidates []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+
+	maxDistance := len(fullCounterName) / 3
+	if maxDistance < 3 {
+		maxDistance = 3
+	}
+	seen := map[string]bool{}
+	matches := []match{}
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		if d := levenshtein(strings.ToLower(fullCounterName), strings.ToLower(c)); d <= maxDistance {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+
+	suggestions := []string{}
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+// parsed -output-template, nil for the default output
+var outputTmpl *template.Template
+
+// values available in -output-template
+type templateData struct {
+	Status     string // OK, WARNING, CRITICAL or UNKNOWN
+	ReturnCode int
+	Node       string
+	Counter    string
+	Instance   string // -o object instance
+	Value      string
+	Warning    string
+	Critical   string
+	Text       string   // plugin output without status and perfdata
+	Perfdata   string   // space separated perfdata
+	Instances  []string // instances of the object in the response
+	LongOutput []string
+}
+
+var templateFuncs = template.FuncMap{
+	"escape": escapeOutput,
+	"join":   strings.Join,
+}
+
+// parse the -output-template, a text/template or @filename
+func parseOutputTemplate(text string) error {
+	if strings.HasPrefix(text, "@") {
+		data, err := ioutil.ReadFile(strings.TrimPrefix(text, "@"))
+		if err != nil {
+			return fmt.Errorf("Can't read output template: %s", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid output template: %s", err)
+	}
+	outputTmpl = tmpl
+	return nil
+}
+
+// plugin output of a result shaped by the -output-template
+func renderTemplate(r *checkResult, perfdata []string) (string, error) {
+	data := templateData{
+		Status:     returnValText(r.returnVal),
+		ReturnCode: r.returnVal,
+		Node:       r.node,
+		Counter:    counterName,
+		Instance:   objectInstance,
+		Value:      r.value,
+		Warning:    r.warning,
+		Critical:   r.critical,
+		Text:       r.text,
+		Perfdata:   strings.Join(perfdata, " "),
+		Instances:  r.instances,
+		LongOutput: r.longOutput,
+	}
+	var b strings.Builder
+	if err := outputTmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
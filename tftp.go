@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// check the Cisco TFTP service of every node: -w and -c are the aborted
+// requests per minute since the previous run, -tftp-not-found the warning
+// range of the not found requests per minute. phones request optional files
+// like ITL and CTL files, a not found rate is normal up to some level. a
+// heartbeat unchanged for -heartbeat-stall is CRITICAL.
+func checkTFTP(nodes []string) *checkResult {
+	object := "Cisco TFTP"
+	if flagGiven("o") {
+		object = perfmonObject(objectInstance)
+	}
+
+	state := currentCheckState()
+	if state == nil {
+		return &checkResult{returnVal: 3, text: "TFTP check needs the state file, see -state-dir"}
+	}
+
+	now := time.Now()
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix := ""
+		if len(nodes) > 1 {
+			labelPrefix = node + "/"
+		}
+		// always fetched, rates and heartbeat need the current values
+		counterEnvelope, _, err := fetchCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+		value := func(counter string) (float64, bool) {
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, object, counter))
+			v, err := strconv.ParseFloat(valueText, 64)
+			return v, found && err == nil
+		}
+
+		returnVal := 0
+		details := []string{}
+
+		if heartbeat, ok := value("HeartBeat"); ok {
+			status, stalled := heartbeatStatus(state, "tftp heartbeat "+node, heartbeat, now)
+			if stalled >= heartbeatStall {
+				returnVal = 2
+				problems = append(problems, fmt.Sprintf("%sheartbeat stalled for %s", labelPrefix, shortDuration(stalled)))
+			}
+			details = append(details, "heartbeat "+status)
+			perfdata = append(perfdata, fmt.Sprintf("%sheartbeat=%sc;;;;", labelPrefix, strconv.FormatFloat(heartbeat, 'f', -1, 64)))
+		} else {
+			returnVal = 3
+			problems = append(problems, fmt.Sprintf("%sHeartBeat n/a", labelPrefix))
+		}
+
+		for _, counter := range []string{"Requests", "RequestsAborted", "RequestsNotFound"} {
+			total, ok := value(counter)
+			if !ok {
+				details = append(details, counter+" n/a")
+				continue
+			}
+			label := labelPrefix + map[string]string{"Requests": "requests", "RequestsAborted": "aborted", "RequestsNotFound": "not_found"}[counter]
+			perfdata = append(perfdata, fmt.Sprintf("%s=%sc;;;0;", label, strconv.FormatFloat(total, 'f', -1, 64)))
+			rate, ok := counterRate(state, "tftp "+node+" "+counter, total, now)
+			if !ok {
+				details = append(details, fmt.Sprintf("%s %s total, rate n/a", counter, strconv.FormatFloat(total, 'f', -1, 64)))
+				continue
+			}
+
+			warning, critical := "", ""
+			counterReturnVal := 0
+			switch counter {
+			case "RequestsAborted":
+				warning, critical = warningThreshold, criticalThreshold
+				counterReturnVal = getNagiosReturnVal(rate, warning, critical)
+			case "RequestsNotFound":
+				warning = tftpNotFoundThreshold
+				if warning != "" && generateAlert(rate, warning) {
+					counterReturnVal = 1
+				}
+			}
+			if counterReturnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s%s %.2f/min %s", labelPrefix, counter, rate, returnValText(counterReturnVal)))
+			}
+			returnVal = worseReturnVal(returnVal, counterReturnVal)
+			details = append(details, fmt.Sprintf("%s %.2f/min", counter, rate))
+			perfdata = append(perfdata, fmt.Sprintf("%s_per_min=%.2f;%s;%s;0;", label, rate, warning, critical))
+		}
+
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(returnVal), strings.Join(details, ", ")))
+	}
+
+	summary := "TFTP OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d nodes: %s", outputPrefix, object, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode tftp
+func dryRunTFTP(object string) (*dryRunPlan, error) {
+	instance := objectInstance
+	if !flagGiven("o") {
+		object, instance = "Cisco TFTP", "Cisco TFTP"
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{object, instance, "HeartBeat", "", "stalled"},
+		{object, instance, "RequestsAborted", warningThreshold + " per minute", criticalThreshold + " per minute"},
+		{object, instance, "RequestsNotFound", tftpNotFoundThreshold + " per minute", ""}}}, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// warning and critical threshold of the counters matching a pattern
+type thresholdRule struct {
+	pattern  string
+	re       *regexp.Regexp
+	warning  string
+	critical string
+}
+
+// glob pattern with * and ? wildcards to regexp. backslashes are literal,
+// they separate object(instance) and counter name.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// read the -thresholds-file lines: pattern warning critical. the pattern is a
+// counter name or object(instance)\counter, both may contain * and ? wildcards.
+func readThresholdsFile(filename string) ([]thresholdRule, error) {
+	lines, err := readListFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read thresholds file: %s", err)
+	}
+	rules := []thresholdRule{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid thresholds file line: %s, use pattern warning critical", line)
+		}
+		pattern := strings.Join(fields[:len(fields)-2], " ")
+		re, err := globRegexp(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid thresholds file pattern: %s", pattern)
+		}
+		rules = append(rules, thresholdRule{pattern, re, fields[len(fields)-2], fields[len(fields)-1]})
+	}
+	return rules, nil
+}
+
+// first rule matching object(instance)\counter, patterns without backslash match the counter name
+func matchThresholdRule(rules []thresholdRule, instanceCounter string) (thresholdRule, bool) {
+	counter := instanceCounter[strings.LastIndex(instanceCounter, "\\")+1:]
+	for _, rule := range rules {
+		name := instanceCounter
+		if !strings.Contains(rule.pattern, "\\") {
+			name = counter
+		}
+		if rule.re.MatchString(name) {
+			return rule, true
+		}
+	}
+	return thresholdRule{}, false
+}
+
+// check all counters of the object of every node against the thresholds file.
+// counters without a matching rule are added as perfdata only.
+func checkObject(nodes []string, object string) *checkResult {
+	rules, err := readThresholdsFile(thresholdsFile)
+	if err != nil {
+		return &checkResult{returnVal: 3, text: err.Error()}
+	}
+
+	combinedReturnVal := 0
+	checked := 0
+	problems := []string{}
+	near := []string{}
+	entries := []listEntry{}
+	children := []childResult{}
+
+	for _, node := range nodes {
+		counterEnvelope, _, err := collectCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			children = append(children, childResult{name: node, returnVal: 3, text: err.Error()})
+			continue
+		}
+		if len(counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo) == 0 {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, emptyCounterDataText([]string{node}, object))
+			children = append(children, childResult{name: node, returnVal: 3, text: emptyCounterDataText([]string{node}, object)})
+			continue
+		}
+
+		prefix := "\\\\" + node + "\\"
+		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+			instanceCounter := strings.TrimPrefix(v.Name.Text, prefix)
+			if (!strings.HasPrefix(instanceCounter, object+"(") && !strings.HasPrefix(instanceCounter, object+"\\")) || !instanceAllowed(instanceOf(instanceCounter)) {
+				continue
+			}
+			label := instanceCounter
+			if len(nodes) > 1 {
+				label = node + "/" + label
+			}
+			valueText := counterValueText(v.Value.Text)
+			value, valueErr := strconv.ParseFloat(valueText, 64)
+			invalid := invalidValue(valueText)
+			if invalid && invalidValueAs == "skip" {
+				continue
+			}
+
+			rule, ok := matchThresholdRule(rules, instanceCounter)
+			if invalid {
+				if ok {
+					checked++
+					combinedReturnVal = worseReturnVal(combinedReturnVal, invalidValueReturnVal())
+					if invalidValueReturnVal() != 0 {
+						problems = append(problems, fmt.Sprintf("%s=%s not available", label, valueText))
+					}
+					children = append(children, childResult{name: label, returnVal: invalidValueReturnVal(), text: fmt.Sprintf("%s not available", valueText)})
+				}
+				entries = append(entries, listEntry{name: label, perfdata: fmt.Sprintf("%s=U;%s;%s;;", label, rule.warning, rule.critical)})
+				continue
+			}
+			if !ok {
+				entries = append(entries, listEntry{name: label, value: value, perfdata: fmt.Sprintf("%s=%s;;;;", label, valueText)})
+				continue
+			}
+			checked++
+			returnVal := 3
+			if valueErr == nil {
+				returnVal = getNagiosReturnVal(value, rule.warning, rule.critical)
+			}
+			combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+			if nearThresholdPercent > 0 && valueErr == nil {
+				if line := nearThresholdText(label, valueText, value, returnVal, rule.warning, rule.critical); line != "" {
+					near = append(near, line)
+				}
+			}
+			if returnVal != 0 {
+				problems = append(problems, fmt.Sprintf("%s=%s %s", label, valueText, returnValText(returnVal)))
+			}
+			children = append(children, childResult{name: label, returnVal: returnVal, text: fmt.Sprintf("%s=%s (%s %s %s)", label, valueText, rule.pattern, rule.warning, rule.critical)})
+			entries = append(entries, listEntry{
+				name:     label,
+				value:    value,
+				line:     fmt.Sprintf("%s=%s %s (%s %s %s)", label, valueText, returnValText(returnVal), rule.pattern, rule.warning, rule.critical),
+				perfdata: fmt.Sprintf("%s=%s;%s;%s;;", label, valueText, rule.warning, rule.critical),
+			})
+		}
+	}
+	longOutput, perfdata := sortLimitEntries(entries)
+	longOutput = append(longOutput, near...)
+
+	summary := "all OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s,%s %d counters checked: %s", outputPrefix, object, checked, summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+		children:      children,
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// time window of -time-thresholds
+type timeWindow struct {
+	spec              string
+	days              [7]bool
+	from, to          int // minutes of the day, to < from wraps past midnight
+	warning, critical string
+}
+
+// parse a day list like Mon-Fri or Sat,Sun
+func parseWeekdays(spec string) ([7]bool, error) {
+	var days [7]bool
+	index := func(name string) (int, error) {
+		for i, n := range weekdayNames {
+			if strings.HasPrefix(strings.ToLower(name), n) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid weekday %s", name)
+	}
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := index(bounds[0])
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = index(bounds[1]); err != nil {
+				return days, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parse a time of day HH:MM to minutes, 24:00 is the end of the day
+func parseTimeOfDay(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %s", s)
+	}
+	return h*60 + m, nil
+}
+
+// parse -time-thresholds: [days] HH:MM-HH:MM=warning,critical entries separated
+// by ; or @filename with one entry per line, e.g. "Mon-Fri 08:00-18:00=80,90;18:00-08:00=40,60"
+func parseTimeThresholds(spec string) ([]timeWindow, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	entries := []string{}
+	if strings.HasPrefix(spec, "@") {
+		lines, err := readListFile(strings.TrimPrefix(spec, "@"))
+		if err != nil {
+			return nil, err
+		}
+		entries = lines
+	} else {
+		entries = strings.Split(spec, ";")
+	}
+
+	windows := []timeWindow{}
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		invalid := fmt.Errorf("invalid time threshold %s, expected [days] HH:MM-HH:MM=warning,critical", entry)
+		pos := strings.Index(entry, "=")
+		if pos == -1 {
+			return nil, invalid
+		}
+		values := strings.Split(entry[pos+1:], ",")
+		fields := strings.Fields(entry[:pos])
+		if len(values) != 2 || len(fields) == 0 || len(fields) > 2 {
+			return nil, invalid
+		}
+		w := timeWindow{spec: strings.Join(fields, " "), warning: strings.TrimSpace(values[0]), critical: strings.TrimSpace(values[1])}
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		if len(fields) == 2 {
+			days, err := parseWeekdays(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", invalid, err)
+			}
+			w.days = days
+		}
+		bounds := strings.SplitN(fields[len(fields)-1], "-", 2)
+		if len(bounds) != 2 {
+			return nil, invalid
+		}
+		var err error
+		if w.from, err = parseTimeOfDay(bounds[0]); err == nil {
+			w.to, err = parseTimeOfDay(bounds[1])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", invalid, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// first window matching the time. the weekday of a window wrapping past
+// midnight is the day it starts.
+func matchTimeWindow(windows []timeWindow, t time.Time) (timeWindow, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	yesterday := (today + 6) % 7
+	for _, w := range windows {
+		switch {
+		case w.from <= w.to:
+			if w.days[today] && minute >= w.from && minute < w.to {
+				return w, true
+			}
+		case minute >= w.from:
+			if w.days[today] {
+				return w, true
+			}
+		case minute < w.to:
+			if w.days[yesterday] {
+				return w, true
+			}
+		}
+	}
+	return timeWindow{}, false
+}
+
+// set by applyTimeThresholds if a -time-thresholds window replaced -w and -c
+var timeWindowActive bool
+
+// -w or -c given on the command line or by the current -time-thresholds
+// window. the modes use their own default for a threshold not given.
+func thresholdGiven(name string) bool {
+	return timeWindowActive || flagGiven(name)
+}
+
+// -w and -c of the modes without own defaults, empty if not given
+func givenThresholds() (string, string) {
+	warning, critical := "", ""
+	if thresholdGiven("w") {
+		warning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		critical = criticalThreshold
+	}
+	return warning, critical
+}
+
+// return value against the given thresholds, an empty threshold is not evaluated
+func givenThresholdsReturnVal(value float64, warning, critical string) int {
+	r := 0
+	if warning != "" && generateAlert(value, warning) {
+		r = 1
+	}
+	if critical != "" && generateAlert(value, critical) {
+		r = 2
+	}
+	return r
+}
+
+// replace -w and -c with the thresholds of the current -time-thresholds window
+func applyTimeThresholds(now time.Time) error {
+	windows, err := parseTimeThresholds(timeThresholdList)
+	if err != nil {
+		return err
+	}
+	if w, ok := matchTimeWindow(windows, now); ok {
+		debugPrintf(3, "time window %s thresholds: %s %s\n", w.spec, w.warning, w.critical)
+		warningThreshold, criticalThreshold = w.warning, w.critical
+		timeWindowActive = true
+	}
+	return nil
+}
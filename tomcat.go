@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// default heap used percent thresholds of -mode tomcat
+const (
+	tomcatHeapWarning  = "85"
+	tomcatHeapCritical = "95"
+)
+
+// check the Tomcat heap of every node from the Cisco Tomcat JVM counters:
+// used percent is KBytesMemoryUsed, or KBytesMemoryTotal - KBytesMemoryFree
+// on versions without it, of KBytesMemoryMax. -w and -c override the
+// default thresholds, garbage collection counters are listed in long output.
+func checkTomcat(nodes []string) *checkResult {
+	object := "Cisco Tomcat JVM"
+	heapWarning, heapCritical := tomcatHeapWarning, tomcatHeapCritical
+	if thresholdGiven("w") {
+		heapWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		heapCritical = criticalThreshold
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	perfdata := []string{}
+	longOutput := []string{}
+
+	for _, node := range nodes {
+		labelPrefix, problemPrefix := "", ""
+		if len(nodes) > 1 {
+			labelPrefix, problemPrefix = node+"/", node+" "
+		}
+		counterEnvelope, _, err := collectCounterData(ipAddr, node, object)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s", node, returnValText(3), err))
+			continue
+		}
+		values := map[string]float64{}
+		for _, counter := range []string{"KBytesMemoryUsed", "KBytesMemoryMax", "KBytesMemoryTotal", "KBytesMemoryFree"} {
+			valueText, found := findCounterValue(counterEnvelope, getFullCounterName(node, object, counter))
+			if v, err := strconv.ParseFloat(valueText, 64); found && err == nil {
+				values[counter] = v
+			}
+		}
+
+		used, hasUsed := values["KBytesMemoryUsed"]
+		if !hasUsed {
+			total, hasTotal := values["KBytesMemoryTotal"]
+			free, hasFree := values["KBytesMemoryFree"]
+			used, hasUsed = total-free, hasTotal && hasFree
+		}
+		max := values["KBytesMemoryMax"]
+		if !hasUsed || max <= 0 {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%sheap counters n/a", problemPrefix))
+			longOutput = append(longOutput, fmt.Sprintf("%s: %s - %s KBytesMemoryUsed or KBytesMemoryMax n/a", node, returnValText(3), object))
+			continue
+		}
+
+		usedPercent := used / max * 100
+		returnVal := getNagiosReturnVal(usedPercent, heapWarning, heapCritical)
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%sheap %.1f percent used %s", problemPrefix, usedPercent, returnValText(returnVal)))
+		}
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+		perfdata = append(perfdata,
+			fmt.Sprintf("%sheap_used_pct=%.1f;%s;%s;0;100", labelPrefix, usedPercent, heapWarning, heapCritical),
+			fmt.Sprintf("%sheap_used=%sKB;;;0;%s", labelPrefix, strconv.FormatFloat(used, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64)))
+		longOutput = append(longOutput, fmt.Sprintf("%s: %s - heap %.0f of %.0f MB used (%.1f percent)", node, returnValText(returnVal), used/1024, max/1024, usedPercent))
+
+		// garbage collection counters of the JVM, names differ between versions
+		prefix := "\\\\" + node + "\\" + object + "\\"
+		for _, v := range counterEnvelope.Body.PerfmonCollectCounterDataResponse.ArrayOfCounterInfo.ArrayOfCounterInfo {
+			counter := strings.TrimPrefix(v.Name.Text, prefix)
+			lower := strings.ToLower(counter)
+			if counter != v.Name.Text && (strings.Contains(lower, "gc") || strings.Contains(lower, "collection")) {
+				longOutput = append(longOutput, fmt.Sprintf("%s: %s=%s", node, counter, counterValueText(v.Value.Text)))
+			}
+		}
+	}
+
+	summary := "heap OK"
+	if len(problems) > 0 {
+		summary = strings.Join(problems, ", ")
+	}
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s %d nodes: %s", outputPrefix, object, len(nodes), summary),
+		extraPerfdata: perfdata,
+		longOutput:    longOutput,
+	}
+}
+
+// -dry-run plan of -mode tomcat
+func dryRunTomcat(object string) (*dryRunPlan, error) {
+	heapWarning, heapCritical := tomcatHeapWarning, tomcatHeapCritical
+	if thresholdGiven("w") {
+		heapWarning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		heapCritical = criticalThreshold
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{"Cisco Tomcat JVM", "Cisco Tomcat JVM", "KBytesMemoryUsed", heapWarning + " percent of KBytesMemoryMax", heapCritical + " percent of KBytesMemoryMax"},
+		{"Cisco Tomcat JVM", "Cisco Tomcat JVM", "KBytesMemoryMax", "", ""}}}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GitHub API of the latest plugin release checked by -check-update
+	latestReleaseURL = "https://api.github.com/repos/hgrimm/check_cisco_uc_perf/releases/latest"
+	// the poller may be offline, don't delay the check for long
+	updateCheckTimeout = 3 * time.Second
+	// the latest release is requested once a day, a failed request again after an hour
+	latestReleaseCacheAge = 24 * 60 * 60
+	latestReleaseRetryAge = time.Hour
+)
+
+// latest GitHub release, cached in the cache directory
+type latestRelease struct {
+	TagName string    `json:"tag_name"`
+	HTMLURL string    `json:"html_url"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// latest release of the cache or the GitHub API
+func fetchLatestRelease() *latestRelease {
+	release := new(latestRelease)
+	if loadStruct("github", "latest release", latestReleaseCacheAge, release) && (release.Error == "" || time.Since(release.Checked) < latestReleaseRetryAge) {
+		return release
+	}
+
+	release = &latestRelease{Checked: time.Now()}
+	client := &http.Client{
+		Timeout: updateCheckTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{Timeout: updateCheckTimeout}).DialContext,
+			TLSClientConfig: fipsTLSConfig(&tls.Config{}),
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err == nil {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("User-Agent", "check_cisco_uc_perf/"+version)
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("HTTP status %s", resp.Status)
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(release)
+			}
+		}
+	}
+	if err != nil {
+		release.Error = err.Error()
+	}
+	saveStruct("github", "latest release", release)
+	return release
+}
+
+// compares dotted version numbers like 0.8 and v0.10.1, negative if a is older than b
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// text about the update availability for -check-update
+func updateText() string {
+	release := fetchLatestRelease()
+	switch {
+	case release.Error != "":
+		return fmt.Sprintf("update check failed, offline or GitHub not reachable: %s", release.Error)
+	case release.TagName == "":
+		return "update check: no release found"
+	case compareVersions(version, release.TagName) < 0:
+		return fmt.Sprintf("update available: %s (running %s), %s", release.TagName, version, release.HTMLURL)
+	}
+	return fmt.Sprintf("up to date: running %s, latest release %s", version, release.TagName)
+}
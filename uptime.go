@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uptime of a node from the -uptime-counter of the System object
+func nodeUptime(ipAddr, nodeIpAddr string) (time.Duration, error) {
+	counterEnvelope, _, err := collectCounterData(ipAddr, nodeIpAddr, "System")
+	if err != nil {
+		return 0, err
+	}
+	fullCounterName := getFullCounterName(nodeIpAddr, "System", uptimeCounter)
+	valueText, found := findCounterValue(counterEnvelope, fullCounterName)
+	if !found {
+		return 0, fmt.Errorf("Counter not found: %s", fullCounterName)
+	}
+	seconds, err := strconv.ParseFloat(valueText, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Counter value string to float64 convert error: %s", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// report WARNING and CRITICAL as OK while the node is up for less than -warmup
+func applyWarmup(r *checkResult) {
+	if warmup <= 0 || (r.returnVal != 1 && r.returnVal != 2) {
+		return
+	}
+	node := r.node
+	if node == "" {
+		node = nodeIpAddr
+	}
+	uptime, err := nodeUptime(ipAddr, node)
+	if err != nil {
+		debugPrintf(2, "warm-up uptime error: %s\n", err)
+		return
+	}
+	if uptime < warmup {
+		r.text += fmt.Sprintf(" (%s suppressed, warming up, uptime %s)", returnValText(r.returnVal), shortDuration(uptime))
+		r.returnVal = 0
+	}
+}
+
+// default thresholds of -mode uptime in seconds: WARNING if rebooted within
+// the last hour or not rebooted (patched) for more than 180 days, CRITICAL if
+// rebooted within the last 10 minutes
+const (
+	uptimeWarning  = "3600:15552000"
+	uptimeCritical = "600:"
+)
+
+// check the uptime of every node. -w and -c are ranges in seconds covering
+// both recently rebooted and not rebooted (patched) for too long, e.g.
+// -w 3600:15552000 -c 600: for WARNING below one hour or above 180 days,
+// which are also the defaults
+func checkUptime(nodes []string) *checkResult {
+	warning, critical := uptimeWarning, uptimeCritical
+	if thresholdGiven("w") {
+		warning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		critical = criticalThreshold
+	}
+
+	combinedReturnVal := 0
+	problems := []string{}
+	summary := []string{}
+	perfdata := []string{}
+
+	for _, node := range nodes {
+		uptime, err := nodeUptime(ipAddr, node)
+		if err != nil {
+			combinedReturnVal = worseReturnVal(combinedReturnVal, 3)
+			problems = append(problems, fmt.Sprintf("%s %s", node, err))
+			continue
+		}
+		seconds := uptime.Seconds()
+		returnVal := getNagiosReturnVal(seconds, warning, critical)
+		combinedReturnVal = worseReturnVal(combinedReturnVal, returnVal)
+
+		text := fmt.Sprintf("%s uptime %s", node, uptimeText(uptime))
+		if returnVal != 0 {
+			problems = append(problems, fmt.Sprintf("%s %s", text, returnValText(returnVal)))
+		} else {
+			summary = append(summary, text)
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%s/uptime=%.0fs;%s;%s;0;", node, seconds, warning, critical))
+	}
+
+	return &checkResult{
+		returnVal:     combinedReturnVal,
+		text:          fmt.Sprintf("%s %s", outputPrefix, strings.Join(append(problems, summary...), ", ")),
+		extraPerfdata: perfdata,
+	}
+}
+
+// uptime as days, hours and minutes
+func uptimeText(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	if days > 0 {
+		return fmt.Sprintf("%dd%dh", days, int(d.Hours())%24)
+	}
+	return shortDuration(d.Truncate(time.Minute))
+}
+
+// -dry-run plan of -mode uptime
+func dryRunUptime(object string) (*dryRunPlan, error) {
+	warning, critical := uptimeWarning, uptimeCritical
+	if thresholdGiven("w") {
+		warning = warningThreshold
+	}
+	if thresholdGiven("c") {
+		critical = criticalThreshold
+	}
+	return &dryRunPlan{queries: []dryRunQuery{{"System", "System", uptimeCounter, warning, critical}}}, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// build information, injected at build time with
+// go build -ldflags "-X main.buildCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	buildCommit = "unknown"
+	buildDate   = "unknown"
+)
+
+// API versions the plugin works with
+var supportedAPIVersions = map[string][]string{
+	"perfmon": {"PerfmonPort SOAP", "perfmon REST (-transport rest)"},
+	"axl":     {"8.5", "9.0", "9.1", "10.0", "10.5", "11.0", "11.5", "12.0", "12.5", "14.0", "15.0"},
+}
+
+// print the version and build information for -V, as JSON with -version-json
+func printVersion() {
+	if versionJSON {
+		info := map[string]interface{}{
+			"name":         path.Base(os.Args[0]),
+			"version":      version,
+			"commit":       buildCommit,
+			"build_date":   buildDate,
+			"go_version":   runtime.Version(),
+			"platform":     runtime.GOOS + "/" + runtime.GOARCH,
+			"api_versions": supportedAPIVersions,
+		}
+		if checkUpdate {
+			info["update"] = updateText()
+		}
+		data, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Printf("%s\n", data)
+		return
+	}
+	fmt.Printf("%s version: %s\n", path.Base(os.Args[0]), version)
+	fmt.Printf("commit: %s\nbuild date: %s\ngo version: %s %s/%s\n", buildCommit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("perfmon API: %s\n", strings.Join(supportedAPIVersions["perfmon"], ", "))
+	fmt.Printf("AXL API versions: %s\n", strings.Join(supportedAPIVersions["axl"], ", "))
+	if checkUpdate {
+		fmt.Printf("%s\n", updateText())
+	}
+}